@@ -0,0 +1,202 @@
+// Command eventreplay replays events of a subject from a sequence or time range
+// into a target subject, a local jsonl file or an http endpoint. Events archived by event.Archiver
+// are replayed from the archive directory with -archive.
+//
+//	eventreplay -subject account -from-seq 100 -to-seq 200 -event-type create -to-subject account.replay
+//	eventreplay -subject account -since 2h -status commit -to-file account.jsonl
+//	eventreplay -subject account -from-time 2019-06-01T00:00:00Z -to-url http://localhost:8080/events -dry-run
+//	eventreplay -archive /var/archive -subject account -from-seq 100 -to-subject account.restored
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/johnjerrico/gokit-starter-pack/pkg/event"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	stan "github.com/nats-io/stan.go"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "eventreplay:", err)
+		if _, ok := err.(usageError); ok {
+			flag.Usage()
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+//usageError invalid combination of flags
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+//run replay subject, deferred broker and sink cleanup completes before it returns
+func run() error {
+	var (
+		natsURL   = flag.String("nats", nats.DefaultURL, "nats server url")
+		clusterID = flag.String("cluster", "test-cluster", "nats streaming cluster id")
+		clientID  = flag.String("client", fmt.Sprintf("eventreplay-%d", os.Getpid()), "nats streaming client id")
+		stream    = flag.String("jetstream", "", "replay from jetstream stream instead of nats streaming")
+		archive   = flag.String("archive", "", "replay from archive directory instead of nats")
+		subject   = flag.String("subject", "", "subject to replay (required)")
+
+		fromSeq  = flag.Uint64("from-seq", 0, "first sequence to replay")
+		toSeq    = flag.Uint64("to-seq", 0, "last sequence to replay")
+		fromTime = flag.String("from-time", "", "replay messages published at or after RFC3339 time")
+		toTime   = flag.String("to-time", "", "replay messages published at or before RFC3339 time")
+		since    = flag.Duration("since", 0, "replay messages published within duration, ex: 2h, exclusive with -from-time")
+		idle     = flag.Duration("idle", 5*time.Second, "stop when no message arrives for duration")
+
+		domains    = flag.String("domain", "", "comma separated domains to replay")
+		models     = flag.String("model", "", "comma separated models to replay")
+		eventTypes = flag.String("event-type", "", "comma separated event types to replay")
+		statuses   = flag.String("status", "", "comma separated statuses to replay (begin, commit, error)")
+
+		toSubject = flag.String("to-subject", "", "republish into subject")
+		toFile    = flag.String("to-file", "", "append records into jsonl file")
+		toURL     = flag.String("to-url", "", "post envelopes into http endpoint")
+		dryRun    = flag.Bool("dry-run", false, "print records to stdout without writing into target")
+	)
+	flag.Parse()
+
+	if *subject == "" {
+		return usageError("-subject is required")
+	}
+	targets := 0
+	for _, target := range []string{*toSubject, *toFile, *toURL} {
+		if target != "" {
+			targets++
+		}
+	}
+	if targets != 1 && !*dryRun {
+		return usageError("exactly one of -to-subject, -to-file or -to-url is required")
+	}
+	if *toSubject == *subject && !*dryRun && *archive == "" {
+		return usageError("-to-subject must differ from -subject, replaying into the replayed subject never ends")
+	}
+	if *since > 0 && *fromTime != "" {
+		return usageError("-since and -from-time can not be used together")
+	}
+
+	filter := event.ReplayFilter{
+		Domains:      split(*domains),
+		Models:       split(*models),
+		EventTypes:   split(*eventTypes),
+		Statuses:     split(*statuses),
+		FromSequence: *fromSeq,
+		ToSequence:   *toSeq,
+	}
+	var err error
+	if filter.FromTime, err = parseTime(*fromTime); err != nil {
+		return err
+	}
+	if filter.ToTime, err = parseTime(*toTime); err != nil {
+		return err
+	}
+	if *since > 0 {
+		filter.FromTime = time.Now().Add(-*since)
+	}
+
+	var broker event.Broker
+	if *archive == "" || (*toSubject != "" && !*dryRun) {
+		var closeBroker func()
+		if broker, closeBroker, err = connect(*natsURL, *clusterID, *clientID, *stream); err != nil {
+			return err
+		}
+		defer closeBroker()
+	}
+
+	var sink event.ReplaySink
+	switch {
+	case *dryRun:
+		sink = event.NewWriterSink(os.Stdout)
+	case *toSubject != "":
+		sink = event.NewSubjectSink(broker, *toSubject)
+	case *toFile != "":
+		if sink, err = event.NewFileSink(*toFile); err != nil {
+			return err
+		}
+	case *toURL != "":
+		sink = event.NewHTTPSink(nil, *toURL)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var stats event.ReplayStats
+	if *archive != "" {
+		stats, err = event.RestoreArchive(ctx, *archive, *subject, filter, sink)
+	} else {
+		stats, err = event.Replay(ctx, broker, *subject, filter, sink, *idle)
+	}
+	if closeErr := sink.Close(); err == nil {
+		err = closeErr
+	}
+	fmt.Fprintf(os.Stderr, "received: %d, replayed: %d, skipped: %d, invalid: %d\n", stats.Received, stats.Replayed, stats.Skipped, stats.Invalid)
+	return err
+}
+
+const drainTimeout = 10 * time.Second
+
+func connect(natsURL, clusterID, clientID, stream string) (event.Broker, func(), error) {
+	if stream != "" {
+		closed := make(chan struct{})
+		nc, err := nats.Connect(natsURL, nats.ClosedHandler(func(*nats.Conn) { close(closed) }))
+		if err != nil {
+			return nil, nil, err
+		}
+		js, err := jetstream.New(nc)
+		if err != nil {
+			nc.Close()
+			return nil, nil, err
+		}
+		//drain flushes pending messages, connection is closed when draining completes
+		drain := func() {
+			if err := nc.Drain(); err != nil {
+				nc.Close()
+			}
+			select {
+			case <-closed:
+			case <-time.After(drainTimeout):
+				nc.Close()
+			}
+		}
+		return event.NewJetStreamBroker(js, stream), drain, nil
+	}
+	sc, err := stan.Connect(clusterID, clientID, stan.NatsURL(natsURL))
+	if err != nil {
+		return nil, nil, err
+	}
+	return event.NewStanBroker(sc), func() { sc.Close() }, nil
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,446 @@
+//Package config fills configuration struct in place from defaults and layered sources such as file, vault, environment and flags
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Field configuration field of struct.
+//Key is taken from `config` tag, `vault` tag or field name, nested struct reads its fields from nested object of its key,
+//embedded struct without the tag reads its fields at the same level. Env is taken from `env` tag, field without it has no env.
+//Flag is taken from `flag` tag or dot joined lower case key, ex: database.host.
+type Field struct {
+	Name       string   //dot separated go path of field, ex: Database.Host
+	Key        []string //key path in nested key/value source, ex: [database host]
+	Env        string
+	Flag       string
+	Usage      string
+	Default    string
+	HasDefault bool
+}
+
+//Source provide raw values of configuration fields, value is either string parsed into field type or value of a decoded document
+type Source interface {
+	Name() string
+	Lookup(field Field) (interface{}, bool)
+}
+
+//FieldError field which can not be set from its source
+type FieldError struct {
+	Field  string
+	Source string
+	Value  interface{}
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("config %s from %s: cannot use %#v: %v", e.Field, e.Source, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+//Load fill struct pointed by dst in place. Zero fields get value of `default` tag, then every source in order overrides
+//the fields it has a value for, null value of decoded document is no value. Conversion failure is returned as *FieldError.
+func Load(dst interface{}, sources ...Source) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config destination must be pointer to struct, got %T", dst)
+	}
+	var fields []field
+	collect(v.Elem(), "", nil, true, nil, &fields)
+
+	for _, f := range fields {
+		if f.HasDefault && f.value.IsZero() {
+			if err := Set(f.value, f.Default); err != nil {
+				return &FieldError{Field: f.Name, Source: "default", Value: f.Default, Err: err}
+			}
+		}
+	}
+	for _, source := range sources {
+		for _, f := range fields {
+			raw, ok := source.Lookup(f.Field)
+			if !ok || raw == nil {
+				continue
+			}
+			if err := Set(f.value, raw); err != nil {
+				return &FieldError{Field: f.Name, Source: source.Name(), Value: raw, Err: err}
+			}
+		}
+	}
+	return nil
+}
+
+//Fields describe configuration fields of struct pointed by dst, dst is not modified
+func Fields(dst interface{}) []Field {
+	t := reflect.TypeOf(dst)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var fields []field
+	if t != nil && t.Kind() == reflect.Struct {
+		collect(reflect.New(t).Elem(), "", nil, false, nil, &fields)
+	}
+	described := make([]Field, len(fields))
+	for i, f := range fields {
+		described[i] = f.Field
+	}
+	return described
+}
+
+//Strings return values of configuration fields of struct pointed by src formatted as strings accepted by Set, keyed by Field.Name.
+//Slices are comma separated, times are RFC3339 and nil pointers are empty strings.
+func Strings(src interface{}) (map[string]string, error) {
+	v := reflect.ValueOf(src)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config source must be pointer to struct, got %T", src)
+	}
+	var fields []field
+	collect(v.Elem(), "", nil, false, nil, &fields)
+	values := make(map[string]string, len(fields))
+	for _, f := range fields {
+		s, err := format(f.value)
+		if err != nil {
+			return nil, &FieldError{Field: f.Name, Source: "struct", Value: f.value.Interface(), Err: err}
+		}
+		values[f.Name] = s
+	}
+	return values, nil
+}
+
+type field struct {
+	Field
+	value reflect.Value
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+//collect walk exported fields of struct, nested structs are walked unless they decode from text.
+//Nil pointer of nested struct is allocated when alloc is set, otherwise its zero value is walked.
+//Nested struct whose type is being walked (recursive type) is skipped.
+func collect(v reflect.Value, prefix string, key []string, alloc bool, visiting []reflect.Type, fields *[]field) {
+	t := v.Type()
+	visiting = append(visiting, t)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, ok := sf.Tag.Lookup("config")
+		if !ok {
+			name = sf.Tag.Get("vault")
+		}
+		if name == "-" {
+			continue
+		}
+		value := v.Field(i)
+		fieldKey := append(append([]string(nil), key...), sf.Name)
+		if name != "" {
+			fieldKey = append(fieldKey[:len(key)], strings.Split(name, ".")...)
+		}
+
+		if isStruct(sf.Type) {
+			if isVisiting(sf.Type, visiting) {
+				continue
+			}
+			if value.Kind() == reflect.Ptr {
+				switch {
+				case !value.IsNil():
+					value = value.Elem()
+				case alloc:
+					value.Set(reflect.New(sf.Type.Elem()))
+					value = value.Elem()
+				default:
+					value = reflect.New(sf.Type.Elem()).Elem()
+				}
+			}
+			nested := fieldKey
+			if sf.Anonymous && name == "" {
+				nested = key
+			}
+			collect(value, prefix+sf.Name+".", nested, alloc, visiting[:len(visiting):len(visiting)], fields)
+			continue
+		}
+
+		def, hasDefault := sf.Tag.Lookup("default")
+		flagName := sf.Tag.Get("flag")
+		if flagName == "" {
+			flagName = strings.ToLower(strings.Join(fieldKey, "."))
+		}
+		*fields = append(*fields, field{
+			Field: Field{
+				Name:       prefix + sf.Name,
+				Key:        fieldKey,
+				Env:        sf.Tag.Get("env"),
+				Flag:       flagName,
+				Usage:      sf.Tag.Get("usage"),
+				Default:    def,
+				HasDefault: hasDefault,
+			},
+			value: value,
+		})
+	}
+}
+
+func isVisiting(t reflect.Type, visiting []reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for _, visited := range visiting {
+		if visited == t {
+			return true
+		}
+	}
+	return false
+}
+
+func isStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+//Set convert raw value into type of v and set it. String is parsed by kind of v: ints, uints, floats, bools,
+//durations (time.ParseDuration), times (RFC3339), comma separated slices and encoding.TextUnmarshaler.
+//Numbers, bools and lists of decoded documents are converted without parsing.
+func Set(v reflect.Value, raw interface{}) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return Set(v.Elem(), raw)
+	}
+	if s, ok := raw.(string); ok {
+		return setString(v, s)
+	}
+	if raw == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	rv := reflect.ValueOf(raw)
+	switch {
+	case v.Kind() == reflect.Slice && (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array):
+		slice := reflect.MakeSlice(v.Type(), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			if err := Set(slice.Index(i), rv.Index(i).Interface()); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		v.Set(slice)
+		return nil
+	case v.Type() == durationType:
+		return fmt.Errorf("duration must be a string such as 1m30s")
+	case rv.Type().ConvertibleTo(v.Type()) && sameClass(rv.Kind(), v.Kind()):
+		converted := rv.Convert(v.Type())
+		if isInt(v.Kind()) || isUint(v.Kind()) {
+			//reject fractions and values overflowing the field
+			if back := converted.Convert(rv.Type()); back.Interface() != rv.Interface() {
+				return fmt.Errorf("%v does not fit into %s", raw, v.Type())
+			}
+		}
+		v.Set(converted)
+		return nil
+	}
+	return setString(v, fmt.Sprint(raw))
+}
+
+//format convert value into string accepted by setString
+func format(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", nil
+		}
+		return format(v.Elem())
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textMarshalerType) {
+		v = v.Addr()
+	}
+	if marshaler, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		return string(text), err
+	}
+	switch {
+	case v.Type() == durationType:
+		return time.Duration(v.Int()).String(), nil
+	case v.Kind() == reflect.Slice:
+		parts := make([]string, v.Len())
+		for i := range parts {
+			part, err := format(v.Index(i))
+			if err != nil {
+				return "", fmt.Errorf("element %d: %w", i, err)
+			}
+			parts[i] = part
+		}
+		return strings.Join(parts, ","), nil
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
+
+func setString(v reflect.Value, s string) error {
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case v.Type() == timeType:
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		var parts []string
+		if strings.TrimSpace(s) != "" {
+			parts = strings.Split(s, ",")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setString(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func isInt(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUint(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uintptr
+}
+
+func isNumber(k reflect.Kind) bool {
+	return isInt(k) || isUint(k) || k == reflect.Float32 || k == reflect.Float64
+}
+
+//sameClass prevent conversions changing meaning, such as number into string
+func sameClass(from, to reflect.Kind) bool {
+	return (isNumber(from) && isNumber(to)) || from == to
+}
+
+//Env source reading field from environment variable of its `env` tag
+func Env() Source {
+	return envSource{}
+}
+
+//EnvPrefix source reading field from environment variable of its `env` tag,
+//field without the tag is read from prefix and upper case key joined by underscore, ex: USER_SERVICE_DATABASE_HOST
+func EnvPrefix(prefix string) Source {
+	return envSource{prefix: prefix}
+}
+
+type envSource struct {
+	prefix string
+}
+
+func (envSource) Name() string { return "env" }
+
+func (s envSource) Lookup(field Field) (interface{}, bool) {
+	name := field.Env
+	if name == "" && s.prefix != "" {
+		name = strings.ToUpper(strings.Join(append([]string{s.prefix}, field.Key...), "_"))
+	}
+	if name == "" {
+		return nil, false
+	}
+	return os.LookupEnv(name)
+}
+
+//Map source reading field by its key path from nested key/value data, ex: decoded vault secret.
+//Key without exact match matches case insensitively.
+func Map(name string, data map[string]interface{}) Source {
+	return mapSource{name: name, data: data}
+}
+
+type mapSource struct {
+	name string
+	data map[string]interface{}
+}
+
+func (s mapSource) Name() string { return s.name }
+
+func (s mapSource) Lookup(field Field) (interface{}, bool) {
+	return lookupKey(s.data, field.Key)
+}
+
+func lookupKey(data map[string]interface{}, key []string) (interface{}, bool) {
+	var node interface{} = data
+	for _, part := range key {
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok := object[part]
+		if !ok {
+			for k, v := range object {
+				if strings.EqualFold(k, part) {
+					value, ok = v, true
+					break
+				}
+			}
+		}
+		if !ok {
+			return nil, false
+		}
+		node = value
+	}
+	return node, true
+}
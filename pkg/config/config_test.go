@@ -0,0 +1,226 @@
+package config
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type database struct {
+	Host    string        `config:"host" default:"localhost"`
+	Port    int           `config:"port" env:"TEST_DB_PORT" default:"5432"`
+	Timeout time.Duration `config:"timeout" default:"5s"`
+}
+
+type testConfig struct {
+	Name     string    `config:"name" default:"user-service"`
+	Brokers  []string  `config:"brokers"`
+	Database database  `config:"database"`
+	Replica  *database `config:"replica"`
+	secret   string
+}
+
+func TestSet(t *testing.T) {
+	var (
+		i   int
+		i8  int8
+		u   uint16
+		f   float64
+		b   bool
+		d   time.Duration
+		tm  time.Time
+		ss  []string
+		is  []int
+		ip  net.IP
+		ptr *int
+	)
+	tests := []struct {
+		name     string
+		target   interface{}
+		raw      interface{}
+		expected interface{}
+		err      string
+	}{
+		{name: "int string", target: &i, raw: "42", expected: 42},
+		{name: "int hex", target: &i, raw: "0x10", expected: 16},
+		{name: "int from float", target: &i, raw: float64(7), expected: 7},
+		{name: "int fraction", target: &i, raw: 7.5, err: "7.5 does not fit into int"},
+		{name: "int8 overflow", target: &i8, raw: "300", err: "value out of range"},
+		{name: "int8 overflow number", target: &i8, raw: 300, err: "300 does not fit into int8"},
+		{name: "int invalid", target: &i, raw: "abc", err: "invalid syntax"},
+		{name: "uint", target: &u, raw: "8080", expected: uint16(8080)},
+		{name: "uint negative", target: &u, raw: "-1", err: "invalid syntax"},
+		{name: "float", target: &f, raw: "0.25", expected: 0.25},
+		{name: "bool", target: &b, raw: "true", expected: true},
+		{name: "bool number", target: &b, raw: 2, err: "invalid syntax"},
+		{name: "duration", target: &d, raw: "1m30s", expected: 90 * time.Second},
+		{name: "duration number", target: &d, raw: 90, err: "duration must be a string such as 1m30s"},
+		{name: "duration invalid", target: &d, raw: "90", err: "missing unit in duration"},
+		{name: "time", target: &tm, raw: "2024-03-01T10:00:00Z", expected: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)},
+		{name: "comma separated slice", target: &ss, raw: "a, b,c", expected: []string{"a", "b", "c"}},
+		{name: "empty slice", target: &ss, raw: " ", expected: []string{}},
+		{name: "list slice", target: &is, raw: []interface{}{1, "2"}, expected: []int{1, 2}},
+		{name: "slice element", target: &is, raw: "1,x", err: "element 1"},
+		{name: "text unmarshaler", target: &ip, raw: "10.0.0.1", expected: net.ParseIP("10.0.0.1")},
+		{name: "pointer", target: &ptr, raw: "3", expected: 3},
+		{name: "nil", target: &i, raw: nil, expected: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := reflect.ValueOf(test.target).Elem()
+			v.Set(reflect.Zero(v.Type()))
+			err := Set(v, test.raw)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("set returned %v, expected %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := v.Interface()
+			if v.Kind() == reflect.Ptr {
+				got = v.Elem().Interface()
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("set %#v, expected %#v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("TEST_DB_PORT", "6432")
+	var cfg testConfig
+	err := Load(&cfg,
+		Map("file", map[string]interface{}{
+			"brokers":  []interface{}{"nats://a:4222", "nats://b:4222"},
+			"database": map[string]interface{}{"host": "db", "timeout": "10s"},
+			"replica":  map[string]interface{}{"host": "replica"},
+		}),
+		Env(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := testConfig{
+		Name:     "user-service",
+		Brokers:  []string{"nats://a:4222", "nats://b:4222"},
+		Database: database{Host: "db", Port: 6432, Timeout: 10 * time.Second},
+		Replica:  &database{Host: "replica", Port: 6432, Timeout: 5 * time.Second},
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Fatalf("loaded %+v, expected %+v", cfg, expected)
+	}
+}
+
+func TestLoadFieldError(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]interface{}
+		message string
+	}{
+		{
+			name:    "nested int",
+			data:    map[string]interface{}{"database": map[string]interface{}{"port": "abc"}},
+			message: `config Database.Port from file: cannot use "abc": strconv.ParseInt: parsing "abc": invalid syntax`,
+		},
+		{
+			name:    "duration",
+			data:    map[string]interface{}{"database": map[string]interface{}{"timeout": 30}},
+			message: `config Database.Timeout from file: cannot use 30: duration must be a string such as 1m30s`,
+		},
+		{
+			name:    "list into int",
+			data:    map[string]interface{}{"database": map[string]interface{}{"port": []interface{}{1}}},
+			message: `config Database.Port from file: cannot use []interface {}{1}: strconv.ParseInt: parsing "[1]": invalid syntax`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cfg testConfig
+			err := Load(&cfg, Map("file", test.data))
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || err.Error() != test.message {
+				t.Fatalf("load returned %v, expected %s", err, test.message)
+			}
+		})
+	}
+
+	var cfg struct {
+		Port int `default:"http"`
+	}
+	if err := Load(&cfg); err == nil || err.Error() != `config Port from default: cannot use "http": strconv.ParseInt: parsing "http": invalid syntax` {
+		t.Fatalf("invalid default returned %v", err)
+	}
+}
+
+func TestLoadDestination(t *testing.T) {
+	var cfg testConfig
+	for _, dst := range []interface{}{nil, cfg, (*testConfig)(nil), new(int)} {
+		if err := Load(dst); err == nil {
+			t.Fatalf("load into %T is accepted", dst)
+		}
+	}
+}
+
+func TestFieldsAndStrings(t *testing.T) {
+	cfg := testConfig{Name: "svc", Brokers: []string{"a", "b"}, Database: database{Host: "db", Port: 5432, Timeout: time.Minute}}
+	var names []string
+	for _, field := range Fields(&cfg) {
+		names = append(names, field.Name+" "+strings.Join(field.Key, ".")+" "+field.Flag)
+	}
+	expected := []string{
+		"Name name name",
+		"Brokers brokers brokers",
+		"Database.Host database.host database.host",
+		"Database.Port database.port database.port",
+		"Database.Timeout database.timeout database.timeout",
+		"Replica.Host replica.host replica.host",
+		"Replica.Port replica.port replica.port",
+		"Replica.Timeout replica.timeout replica.timeout",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("fields %v, expected %v", names, expected)
+	}
+	if cfg.Replica != nil {
+		t.Fatal("describing fields allocates nested struct")
+	}
+
+	values, err := Strings(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["Brokers"] != "a,b" || values["Database.Timeout"] != "1m0s" || values["Database.Port"] != "5432" || values["Replica.Host"] != "" {
+		t.Fatalf("strings %v", values)
+	}
+	if _, ok := values["secret"]; ok || cfg.Replica != nil {
+		t.Fatalf("strings %v read unexported field or allocated nested struct", values)
+	}
+
+	//strings are accepted by Load
+	var loaded testConfig
+	if err = Load(&loaded, byName(values)); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Name != cfg.Name || !reflect.DeepEqual(loaded.Brokers, cfg.Brokers) || loaded.Database != cfg.Database {
+		t.Fatalf("loaded %+v from strings, expected %+v", loaded, cfg)
+	}
+	if _, err = Strings(cfg); err == nil {
+		t.Fatal("strings of struct value is accepted")
+	}
+}
+
+//byName source reading field by its name
+type byName map[string]string
+
+func (byName) Name() string { return "names" }
+
+func (n byName) Lookup(field Field) (interface{}, bool) {
+	value, ok := n[field.Name]
+	return value, ok && value != ""
+}
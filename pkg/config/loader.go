@@ -0,0 +1,170 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//Layer precedence of source in Loader, source of higher layer overrides fields set by lower layers
+type Layer int
+
+const (
+	//LayerFile local yaml or json file
+	LayerFile Layer = (iota + 1) * 10
+	//LayerVaultGlobal vault config/global
+	LayerVaultGlobal
+	//LayerVaultPath vault config/{path}
+	LayerVaultPath
+	//LayerEnv environment variables
+	LayerEnv
+	//LayerFlags command line flags
+	LayerFlags
+)
+
+//Fetcher source reading its values once before fields are looked up, ex: file or vault
+type Fetcher interface {
+	Fetch(ctx context.Context) error
+}
+
+//Loader fill configuration struct from `default` tags and layered sources.
+//Sources of the same layer apply in the order they were added, custom source may use any layer between the predefined ones.
+type Loader struct {
+	layers []layered
+}
+
+type layered struct {
+	layer  Layer
+	source Source
+}
+
+//NewLoader create loader without sources, it only applies `default` tags
+func NewLoader() *Loader {
+	return &Loader{}
+}
+
+//With add source at layer
+func (l *Loader) With(layer Layer, source Source) *Loader {
+	l.layers = append(l.layers, layered{layer: layer, source: source})
+	return l
+}
+
+//Sources return names of sources from the lowest to the highest layer
+func (l *Loader) Sources() []string {
+	var names []string
+	for _, entry := range l.sorted() {
+		names = append(names, entry.source.Name())
+	}
+	return names
+}
+
+//Load fetch every source and fill struct pointed by dst in place, see Load for conversions
+func (l *Loader) Load(ctx context.Context, dst interface{}) error {
+	var sources []Source
+	for _, entry := range l.sorted() {
+		if fetcher, ok := entry.source.(Fetcher); ok {
+			if err := fetcher.Fetch(ctx); err != nil {
+				return fmt.Errorf("config source %s: %w", entry.source.Name(), err)
+			}
+		}
+		sources = append(sources, entry.source)
+	}
+	return Load(dst, sources...)
+}
+
+func (l *Loader) sorted() []layered {
+	layers := append([]layered(nil), l.layers...)
+	sort.SliceStable(layers, func(i, j int) bool { return layers[i].layer < layers[j].layer })
+	return layers
+}
+
+//File source reading yaml or json file by its extension (.yaml, .yml or .json), missing file fails Load
+func File(path string) Source {
+	return &fileSource{path: path}
+}
+
+//OptionalFile source reading yaml or json file when it exists, ex: local overrides for development
+func OptionalFile(path string) Source {
+	return &fileSource{path: path, optional: true}
+}
+
+type fileSource struct {
+	path     string
+	optional bool
+	data     map[string]interface{}
+}
+
+func (s *fileSource) Name() string { return "file " + s.path }
+
+func (s *fileSource) Fetch(ctx context.Context) error {
+	content, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) && s.optional {
+		s.data = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var data map[string]interface{}
+	switch strings.ToLower(filepath.Ext(s.path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &data)
+	case ".json":
+		err = json.Unmarshal(content, &data)
+	default:
+		err = fmt.Errorf("unsupported file extension %s", filepath.Ext(s.path))
+	}
+	if err != nil {
+		return err
+	}
+	s.data = data
+	return nil
+}
+
+func (s *fileSource) Lookup(field Field) (interface{}, bool) {
+	return lookupKey(s.data, field.Key)
+}
+
+//RegisterFlags define string flag of every field of struct pointed by dst in flag set, named by Field.Flag.
+//Default of flag shows `default` tag, only flags given on command line override other sources.
+func RegisterFlags(fs *flag.FlagSet, dst interface{}) {
+	for _, field := range Fields(dst) {
+		if fs.Lookup(field.Flag) != nil {
+			continue
+		}
+		usage := field.Usage
+		if usage == "" {
+			usage = field.Name
+		}
+		fs.String(field.Flag, field.Default, usage)
+	}
+}
+
+//Flags source reading field from flag named by Field.Flag which was set on command line, see RegisterFlags
+func Flags(fs *flag.FlagSet) Source {
+	return flagSource{fs: fs}
+}
+
+type flagSource struct {
+	fs *flag.FlagSet
+}
+
+func (flagSource) Name() string { return "flags" }
+
+func (s flagSource) Lookup(field Field) (interface{}, bool) {
+	var value interface{}
+	found := false
+	s.fs.Visit(func(f *flag.Flag) {
+		if f.Name == field.Flag {
+			value, found = f.Value.String(), true
+		}
+	})
+	return value, found
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type Location struct {
+	Region string `default:"eu"`
+}
+
+type service struct {
+	Location
+	Name     string `default:"svc"`
+	Database struct {
+		Host string `default:"localhost"`
+		Port int    `default:"5432"`
+	}
+}
+
+type node struct {
+	Name string
+	Next *node
+	Tree struct {
+		Parent *node
+		Label  string
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoaderNestedKeys(t *testing.T) {
+	var described []string
+	for _, field := range Fields(&service{}) {
+		described = append(described, field.Name+" "+field.Flag)
+	}
+	expected := []string{"Location.Region region", "Name name", "Database.Host database.host", "Database.Port database.port"}
+	if !reflect.DeepEqual(described, expected) {
+		t.Fatalf("fields %v, expected %v", described, expected)
+	}
+
+	file := writeFile(t, "config.yaml", "region: us\nname: ~\nhost: wrong\ndatabase:\n  host: db\n  port: ~\n")
+	t.Setenv("APP_DATABASE_PORT", "6432")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var cfg service
+	RegisterFlags(fs, &cfg)
+	if err := fs.Parse([]string{"-database.host=flag"}); err != nil {
+		t.Fatal(err)
+	}
+	err := NewLoader().
+		With(LayerFlags, Flags(fs)).
+		With(LayerEnv, EnvPrefix("APP")).
+		With(LayerFile, File(file)).
+		Load(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Region != "us" || cfg.Name != "svc" || cfg.Database.Host != "flag" || cfg.Database.Port != 6432 {
+		t.Fatalf("loaded %+v", cfg)
+	}
+}
+
+func TestLoaderNullKeepsLowerLayer(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		expected string
+	}{
+		{name: "yaml null", file: "config.yaml", expected: "svc"},
+		{name: "json null", file: "config.json", expected: "svc"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content := "name: ~\n"
+			if filepath.Ext(test.file) == ".json" {
+				content = `{"name": null}`
+			}
+			var cfg service
+			err := NewLoader().
+				With(LayerFile, File(writeFile(t, test.file, content))).
+				With(LayerVaultPath, Map("vault", map[string]interface{}{"name": nil})).
+				Load(context.Background(), &cfg)
+			if err != nil || cfg.Name != test.expected {
+				t.Fatalf("loaded %q, err %v, expected default", cfg.Name, err)
+			}
+		})
+	}
+}
+
+func TestLoaderRecursiveType(t *testing.T) {
+	var described []string
+	for _, field := range Fields(&node{}) {
+		described = append(described, field.Name)
+	}
+	if !reflect.DeepEqual(described, []string{"Name", "Tree.Label"}) {
+		t.Fatalf("fields %v of recursive type", described)
+	}
+	var cfg node
+	err := NewLoader().With(LayerFile, Map("file", map[string]interface{}{"Name": "root", "Tree": map[string]interface{}{"Label": "l"}})).Load(context.Background(), &cfg)
+	if err != nil || cfg.Name != "root" || cfg.Tree.Label != "l" || cfg.Next != nil {
+		t.Fatalf("loaded %+v, err %v", cfg, err)
+	}
+}
+
+func TestLoaderFile(t *testing.T) {
+	var cfg service
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	if err := NewLoader().With(LayerFile, OptionalFile(missing)).Load(context.Background(), &cfg); err != nil || cfg.Name != "svc" {
+		t.Fatalf("optional missing file returned %v, loaded %+v", err, cfg)
+	}
+	if err := NewLoader().With(LayerFile, File(missing)).Load(context.Background(), &cfg); err == nil {
+		t.Fatal("missing file is accepted")
+	}
+	if err := NewLoader().With(LayerFile, File(writeFile(t, "config.toml", ""))).Load(context.Background(), &cfg); err == nil {
+		t.Fatal("unsupported file extension is accepted")
+	}
+}
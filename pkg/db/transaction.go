@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const afterCommitKey key = 1
+
+//ErrNoAfterCommit context holds transaction which was not started by RunInTransactionContext or RunInNewTransaction,
+//so function registered by AfterCommit can not wait for its commit
+var ErrNoAfterCommit = errors.New("transaction of context does not run after commit functions, use db.RunInTransactionContext")
+
+type afterCommit struct {
+	mu    sync.Mutex
+	hooks []func()
+}
+
+//RunInTransactionContext runs function with context holding the transaction (see QueryableFromContext),
+//functions registered by AfterCommit run after the transaction commits. Context already holding such transaction joins it.
+func RunInTransactionContext(ctx context.Context, db *sqlx.DB, f func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(afterCommitKey).(*afterCommit); ok {
+		return f(ctx)
+	}
+	return RunInNewTransaction(ctx, db, func(ctx context.Context, tx *sqlx.Tx) error {
+		return f(ctx)
+	})
+}
+
+//RunInNewTransaction runs function within new transaction even when context already holds one, rollback when it fails.
+//Context given to function holds the transaction and functions registered by AfterCommit run after it commits.
+func RunInNewTransaction(ctx context.Context, db *sqlx.DB, f func(ctx context.Context, tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	hooks := &afterCommit{}
+	if err = f(context.WithValue(NewContext(ctx, tx), afterCommitKey, hooks), tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error when committing transaction: %v", err)
+	}
+
+	hooks.mu.Lock()
+	registered := hooks.hooks
+	hooks.hooks = nil
+	hooks.mu.Unlock()
+	for _, hook := range registered {
+		hook()
+	}
+	return nil
+}
+
+//AfterCommit register function run after transaction of context commits, it is dropped when the transaction rolls back.
+//Without transaction function runs immediately. Transaction put into context by NewContext only can not be awaited,
+//so function is not run and ErrNoAfterCommit is returned.
+func AfterCommit(ctx context.Context, f func()) error {
+	hooks, ok := ctx.Value(afterCommitKey).(*afterCommit)
+	if !ok {
+		if inTransaction(ctx) {
+			return ErrNoAfterCommit
+		}
+		f()
+		return nil
+	}
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	hooks.hooks = append(hooks.hooks, f)
+	return nil
+}
+
+func inTransaction(ctx context.Context) bool {
+	switch q := ctx.Value(queryableKey).(type) {
+	case *sqlx.Tx:
+		return true
+	case *QueryableContext:
+		return q.Tx() != nil
+	}
+	return false
+}
@@ -146,3 +146,13 @@ func New(err error, kind Kind, message string) *Error {
 func (d *Error) Error() string {
 	return d.err
 }
+
+//Kind return kind of error
+func (d *Error) Kind() Kind {
+	return d.kind
+}
+
+//Message return message of error
+func (d *Error) Message() string {
+	return d.message
+}
@@ -2,7 +2,6 @@ package event
 
 import (
 	"github.com/go-kit/kit/endpoint"
-	stan "github.com/nats-io/stan.go"
 )
 
 //IEvent ...
@@ -11,6 +10,7 @@ type IEvent interface {
 		domain, model, eventType, subject, eventSource string,
 		f endpoint.Endpoint,
 		metaBuilder MetaBuilder,
+		opts ...StoreOption,
 	) endpoint.Endpoint
-	Subscribe() *stan.Subscription
+	Subscribe() Subscription
 }
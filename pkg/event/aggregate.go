@@ -0,0 +1,352 @@
+package event
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/johnjerrico/gokit-starter-pack/pkg/db"
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+)
+
+const (
+	//EventStoreTable table storing aggregate events
+	EventStoreTable = "event_store"
+	//SnapshotTable table storing latest aggregate snapshot
+	SnapshotTable = "event_snapshots"
+)
+
+//Aggregate event sourced entity, state must be json serializable when snapshots are enabled
+type Aggregate interface {
+	AggregateID() string
+	AggregateType() string
+	Apply(envelope *Envelope) error
+}
+
+//DomainEvent event raised by aggregate
+type DomainEvent struct {
+	EventType string
+	Data      interface{}
+}
+
+//AggregateStore append and load aggregate events from sql event table
+type AggregateStore struct {
+	db            *sqlx.DB
+	domain        string
+	logger        log.Logger
+	upcasters     *Upcasters
+	snapshotEvery int
+	mirror        Broker
+	outbox        *Scheduler
+	subject       string
+}
+
+//AggregateStoreOption sets optional parameter of AggregateStore
+type AggregateStoreOption func(*AggregateStore)
+
+//AggregateStoreSnapshots store aggregate snapshot every n versions
+func AggregateStoreSnapshots(every int) AggregateStoreOption {
+	return func(s *AggregateStore) { s.snapshotEvery = every }
+}
+
+//AggregateStoreMirror publish appended events into subject after they are committed, failed publish is only logged.
+//Use AggregateStoreOutbox when subscribers must receive every event.
+func AggregateStoreMirror(broker Broker, subject string) AggregateStoreOption {
+	return func(s *AggregateStore) {
+		s.mirror = broker
+		s.subject = subject
+	}
+}
+
+//AggregateStoreOutbox schedule appended events into subject within the saving transaction,
+//scheduler publishes them at least once after they are committed and retries failed publish
+func AggregateStoreOutbox(scheduler *Scheduler, subject string) AggregateStoreOption {
+	return func(s *AggregateStore) {
+		s.outbox = scheduler
+		s.subject = subject
+	}
+}
+
+//AggregateStoreUpcasters stamps appended events with current schema version and upcast loaded events
+func AggregateStoreUpcasters(upcasters *Upcasters) AggregateStoreOption {
+	return func(s *AggregateStore) { s.upcasters = upcasters }
+}
+
+//NewAggregateStore create aggregate store of domain
+func NewAggregateStore(conn *sqlx.DB, domain string, logger log.Logger, opts ...AggregateStoreOption) *AggregateStore {
+	s := &AggregateStore{
+		db:     conn,
+		domain: domain,
+		logger: logger,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+//EnsureTables create event and snapshot tables when they do not exist
+func (s *AggregateStore) EnsureTables() error {
+	if _, err := s.db.Exec("CREATE TABLE IF NOT EXISTS " + EventStoreTable + ` (
+		aggregate_type VARCHAR(255) NOT NULL,
+		aggregate_id VARCHAR(255) NOT NULL,
+		version BIGINT NOT NULL,
+		event_type VARCHAR(255) NOT NULL,
+		envelope TEXT NOT NULL,
+		created_at BIGINT NOT NULL,
+		PRIMARY KEY (aggregate_type, aggregate_id, version)
+	)`); err != nil {
+		return err
+	}
+	_, err := s.db.Exec("CREATE TABLE IF NOT EXISTS " + SnapshotTable + ` (
+		aggregate_type VARCHAR(255) NOT NULL,
+		aggregate_id VARCHAR(255) NOT NULL,
+		version BIGINT NOT NULL,
+		state TEXT NOT NULL,
+		PRIMARY KEY (aggregate_type, aggregate_id)
+	)`)
+	return err
+}
+
+//Save append events of aggregate after expected version and apply them into aggregate once they are committed,
+//aggregate is left unchanged when saving fails. It fails with CONFLICT error when aggregate version is not the expected version,
+//returns new version. Error of applying committed events is returned with the new version.
+//Transaction of context started by db.RunInTransactionContext is joined, aggregate is then changed and mirror is published
+//after that transaction commits and error of applying events is logged.
+func (s *AggregateStore) Save(ctx context.Context, aggregate Aggregate, expectedVersion int, events ...DomainEvent) (int, error) {
+	aggregateType, aggregateID := aggregate.AggregateType(), aggregate.AggregateID()
+	if len(events) == 0 {
+		return expectedVersion, nil
+	}
+	version := expectedVersion + len(events)
+
+	var applyErr error
+	returned := false
+	err := db.RunInTransactionContext(ctx, s.db, func(ctx context.Context) error {
+		q, ok := db.QueryableFromContext(ctx)
+		if !ok {
+			return fmt.Errorf("context of aggregate %s %s holds no transaction", aggregateType, aggregateID)
+		}
+		current, err := s.version(ctx, q, aggregateType, aggregateID)
+		if err != nil {
+			return err
+		}
+		if current != expectedVersion {
+			return conflict(aggregateType, aggregateID, expectedVersion, current)
+		}
+
+		var envelopes []*Envelope
+		for i, e := range events {
+			envelope, err := s.envelope(ctx, aggregateType, aggregateID, expectedVersion+i+1, e)
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(envelope)
+			if err != nil {
+				return err
+			}
+			if _, err = q.NamedExecContext(ctx,
+				"INSERT INTO "+EventStoreTable+" (aggregate_type, aggregate_id, version, event_type, envelope, created_at) VALUES (:aggregate_type, :aggregate_id, :version, :event_type, :envelope, :created_at)",
+				map[string]interface{}{
+					"aggregate_type": aggregateType,
+					"aggregate_id":   aggregateID,
+					"version":        envelope.AggregateVersion,
+					"event_type":     envelope.EventType,
+					"envelope":       string(data),
+					"created_at":     time.Now().UnixNano(),
+				},
+			); err != nil {
+				return err
+			}
+			if s.outbox != nil {
+				//scheduled within the transaction, so outbox publishes every committed event at least once
+				if _, err = s.outbox.Schedule(ctx, s.subject, envelope, time.Now()); err != nil {
+					return err
+				}
+			}
+			envelopes = append(envelopes, envelope)
+		}
+
+		if s.snapshotEvery > 0 && version/s.snapshotEvery > expectedVersion/s.snapshotEvery {
+			//snapshot is taken from copy, aggregate is changed only after events are committed
+			snapshot, err := cloneAggregate(aggregate)
+			if err != nil {
+				return err
+			}
+			for _, envelope := range envelopes {
+				if err = snapshot.Apply(envelope); err != nil {
+					return err
+				}
+			}
+			if err = saveSnapshot(ctx, q, snapshot, version); err != nil {
+				return err
+			}
+		}
+		return db.AfterCommit(ctx, func() {
+			for _, envelope := range envelopes {
+				if applyErr = aggregate.Apply(envelope); applyErr != nil {
+					if returned {
+						s.logger.Log("error_apply_aggregate_event", applyErr, "aggregate_id", aggregateID, "version", envelope.AggregateVersion)
+					}
+					break
+				}
+			}
+			s.publishMirror(aggregateID, envelopes)
+		})
+	})
+	returned = true
+	if err != nil {
+		if _, ok := err.(*rError.Error); !ok {
+			if current, verr := s.version(ctx, s.db, aggregateType, aggregateID); verr == nil && current != expectedVersion {
+				return expectedVersion, conflict(aggregateType, aggregateID, expectedVersion, current)
+			}
+		}
+		return expectedVersion, err
+	}
+	return version, applyErr
+}
+
+//publishMirror publish committed events into mirror subject, failure is logged and event is not retried
+func (s *AggregateStore) publishMirror(aggregateID string, envelopes []*Envelope) {
+	if s.mirror == nil {
+		return
+	}
+	for _, envelope := range envelopes {
+		data, err := json.Marshal(envelope)
+		if err == nil {
+			err = s.mirror.Publish(s.subject, data)
+		}
+		if err != nil {
+			s.logger.Log("error_publish_aggregate_event", err, "aggregate_id", aggregateID, "version", envelope.AggregateVersion)
+		}
+	}
+}
+
+//Load restore aggregate from its latest snapshot and replay events after it, returns aggregate version.
+//It fails with NOTFOUND error when aggregate has no event.
+func (s *AggregateStore) Load(ctx context.Context, aggregate Aggregate) (int, error) {
+	aggregateType, aggregateID := aggregate.AggregateType(), aggregate.AggregateID()
+
+	var version int
+	var snapshot struct {
+		Version int    `db:"version"`
+		State   string `db:"state"`
+	}
+	err := s.db.GetContext(ctx, &snapshot, s.db.Rebind("SELECT version, state FROM "+SnapshotTable+" WHERE aggregate_type = ? AND aggregate_id = ?"), aggregateType, aggregateID)
+	switch {
+	case err == nil:
+		if err = json.Unmarshal([]byte(snapshot.State), aggregate); err != nil {
+			return 0, err
+		}
+		version = snapshot.Version
+	case err != sql.ErrNoRows:
+		return 0, err
+	}
+
+	var rows []string
+	if err = s.db.SelectContext(ctx, &rows, s.db.Rebind("SELECT envelope FROM "+EventStoreTable+" WHERE aggregate_type = ? AND aggregate_id = ? AND version > ? ORDER BY version"), aggregateType, aggregateID, version); err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		var envelope Envelope
+		if err = json.Unmarshal([]byte(row), &envelope); err != nil {
+			return 0, err
+		}
+		if s.upcasters != nil {
+			if err = s.upcasters.Upcast(&envelope); err != nil {
+				return 0, err
+			}
+		}
+		if err = aggregate.Apply(&envelope); err != nil {
+			return 0, err
+		}
+		version = envelope.AggregateVersion
+	}
+
+	if version == 0 {
+		return 0, rError.New(fmt.Errorf("aggregate %s %s not found", aggregateType, aggregateID), rError.Enum.NOTFOUND, "aggregate_not_found")
+	}
+	return version, nil
+}
+
+func (s *AggregateStore) envelope(ctx context.Context, aggregateType, aggregateID string, version int, e DomainEvent) (*Envelope, error) {
+	envelope := &Envelope{
+		Domain:           s.domain,
+		Model:            aggregateType,
+		Status:           StatusCommit,
+		EventType:        e.EventType,
+		SchemaVersion:    1,
+		AggregateID:      aggregateID,
+		AggregateVersion: version,
+	}
+	if s.upcasters != nil {
+		envelope.SchemaVersion = s.upcasters.Current(s.domain, aggregateType, e.EventType)
+	}
+	envelope.Inject(ctx)
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return nil, err
+	}
+	envelope.Data = data
+	return envelope, nil
+}
+
+func (s *AggregateStore) version(ctx context.Context, q db.Queryable, aggregateType, aggregateID string) (int, error) {
+	var version sql.NullInt64
+	if err := q.GetContext(ctx, &version, q.Rebind("SELECT MAX(version) FROM "+EventStoreTable+" WHERE aggregate_type = ? AND aggregate_id = ?"), aggregateType, aggregateID); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+func saveSnapshot(ctx context.Context, q db.Queryable, aggregate Aggregate, version int) error {
+	state, err := json.Marshal(aggregate)
+	if err != nil {
+		return err
+	}
+	arg := map[string]interface{}{
+		"aggregate_type": aggregate.AggregateType(),
+		"aggregate_id":   aggregate.AggregateID(),
+		"version":        version,
+		"state":          string(state),
+	}
+	res, err := q.NamedExecContext(ctx, "UPDATE "+SnapshotTable+" SET version = :version, state = :state WHERE aggregate_type = :aggregate_type AND aggregate_id = :aggregate_id", arg)
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected > 0 {
+		return err
+	}
+	_, err = q.NamedExecContext(ctx, "INSERT INTO "+SnapshotTable+" (aggregate_type, aggregate_id, version, state) VALUES (:aggregate_type, :aggregate_id, :version, :state)", arg)
+	return err
+}
+
+//cloneAggregate copy aggregate through its json state
+func cloneAggregate(aggregate Aggregate) (Aggregate, error) {
+	v := reflect.ValueOf(aggregate)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil, fmt.Errorf("aggregate %s must be a pointer to take snapshot, got %T", aggregate.AggregateType(), aggregate)
+	}
+	state, err := json.Marshal(aggregate)
+	if err != nil {
+		return nil, err
+	}
+	clone := reflect.New(v.Elem().Type())
+	if err = json.Unmarshal(state, clone.Interface()); err != nil {
+		return nil, err
+	}
+	return clone.Interface().(Aggregate), nil
+}
+
+func conflict(aggregateType, aggregateID string, expected, current int) error {
+	return rError.New(
+		fmt.Errorf("aggregate %s %s is at version %d, expected version %d", aggregateType, aggregateID, current, expected),
+		rError.Enum.CONFLICT,
+		"aggregate_version_conflict",
+	)
+}
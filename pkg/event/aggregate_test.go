@@ -0,0 +1,170 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/johnjerrico/gokit-starter-pack/pkg/db"
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+)
+
+type testAccount struct {
+	ID      string `json:"id"`
+	Balance int    `json:"balance"`
+}
+
+type testDeposit struct {
+	Amount int `json:"amount"`
+}
+
+func (a *testAccount) AggregateID() string   { return a.ID }
+func (a *testAccount) AggregateType() string { return "account" }
+func (a *testAccount) Apply(envelope *Envelope) error {
+	var deposit testDeposit
+	if err := envelope.Decode(&deposit); err != nil {
+		return err
+	}
+	a.Balance += deposit.Amount
+	return nil
+}
+
+func deposits(amounts ...int) []DomainEvent {
+	var events []DomainEvent
+	for _, amount := range amounts {
+		events = append(events, DomainEvent{EventType: "deposit", Data: testDeposit{Amount: amount}})
+	}
+	return events
+}
+
+func newAggregateStore(t *testing.T, opts ...AggregateStoreOption) *AggregateStore {
+	t.Helper()
+	store := NewAggregateStore(openDB(t), "bank", log.NewNopLogger(), opts...)
+	if err := store.EnsureTables(); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestAggregateStoreSnapshot(t *testing.T) {
+	store := newAggregateStore(t, AggregateStoreSnapshots(3))
+	ctx := context.Background()
+	account := &testAccount{ID: "a1"}
+	version, err := store.Save(ctx, account, 0, deposits(10, 20, 30)...)
+	if err != nil || version != 3 || account.Balance != 60 {
+		t.Fatalf("saved version %d balance %d, err %v", version, account.Balance, err)
+	}
+	var snapshot int
+	if err = store.db.Get(&snapshot, "SELECT version FROM "+SnapshotTable+" WHERE aggregate_id = 'a1'"); err != nil || snapshot != 3 {
+		t.Fatalf("snapshot version %d, err %v", snapshot, err)
+	}
+	if version, err = store.Save(ctx, account, version, deposits(40)...); err != nil || version != 4 {
+		t.Fatalf("saved version %d, err %v", version, err)
+	}
+
+	//events after snapshot are applied onto restored state
+	if _, err = store.db.Exec("UPDATE " + SnapshotTable + ` SET state = '{"id":"a1","balance":1000}'`); err != nil {
+		t.Fatal(err)
+	}
+	loaded := &testAccount{ID: "a1"}
+	if version, err = store.Load(ctx, loaded); err != nil || version != 4 || loaded.Balance != 1040 {
+		t.Fatalf("loaded version %d balance %d, err %v", version, loaded.Balance, err)
+	}
+
+	_, err = store.Load(ctx, &testAccount{ID: "a2"})
+	if rerr, ok := err.(*rError.Error); !ok || rerr.Kind() != rError.Enum.NOTFOUND {
+		t.Fatalf("loading unknown aggregate returned %v", err)
+	}
+}
+
+func TestAggregateStoreVersionConflict(t *testing.T) {
+	store := newAggregateStore(t)
+	ctx := context.Background()
+	account := &testAccount{ID: "a1"}
+	if _, err := store.Save(ctx, account, 0, deposits(10)...); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := &testAccount{ID: "a1"}
+	version, err := store.Save(ctx, stale, 0, deposits(5)...)
+	if rerr, ok := err.(*rError.Error); !ok || rerr.Kind() != rError.Enum.CONFLICT {
+		t.Fatalf("stale save returned %v", err)
+	}
+	if version != 0 || stale.Balance != 0 {
+		t.Fatalf("failed save changed aggregate into version %d balance %d", version, stale.Balance)
+	}
+	if version, err = store.Load(ctx, stale); err != nil || version != 1 || stale.Balance != 10 {
+		t.Fatalf("loaded version %d balance %d, err %v", version, stale.Balance, err)
+	}
+}
+
+func TestAggregateStoreJoinsTransaction(t *testing.T) {
+	store := newAggregateStore(t)
+	ctx := context.Background()
+	account := &testAccount{ID: "a1"}
+
+	rollback := errors.New("rollback")
+	err := db.RunInTransactionContext(ctx, store.db, func(ctx context.Context) error {
+		if _, err := store.Save(ctx, account, 0, deposits(10)...); err != nil {
+			return err
+		}
+		return rollback
+	})
+	if err != rollback || account.Balance != 0 {
+		t.Fatalf("rolled back save returned %v, balance %d", err, account.Balance)
+	}
+	if _, err = store.Load(ctx, &testAccount{ID: "a1"}); err == nil {
+		t.Fatal("rolled back events are stored")
+	}
+
+	err = db.RunInTransactionContext(ctx, store.db, func(ctx context.Context) error {
+		if _, err := store.Save(ctx, account, 0, deposits(10)...); err != nil {
+			return err
+		}
+		if account.Balance != 0 {
+			t.Error("aggregate is changed before transaction commits")
+		}
+		return nil
+	})
+	if err != nil || account.Balance != 10 {
+		t.Fatalf("committed save returned %v, balance %d", err, account.Balance)
+	}
+}
+
+func TestAggregateStoreOutbox(t *testing.T) {
+	conn := openDB(t)
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	scheduler := NewScheduler(conn, broker, log.NewNopLogger())
+	if err := scheduler.EnsureTable(); err != nil {
+		t.Fatal(err)
+	}
+	store := NewAggregateStore(conn, "bank", log.NewNopLogger(), AggregateStoreOutbox(scheduler, "account"))
+	if err := store.EnsureTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Save(context.Background(), &testAccount{ID: "a1"}, 0, deposits(10, 20)...); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := scheduler.Deliver(context.Background(), time.Now()); err != nil || n != 2 {
+		t.Fatalf("outbox published %d events, err %v", n, err)
+	}
+	messages := broker.Messages("account")
+	if len(messages) != 2 {
+		t.Fatalf("published %d events, expected 2", len(messages))
+	}
+	versions := make(map[int]bool)
+	for _, msg := range messages {
+		envelope, err := UnmarshalEnvelope(msg.Data)
+		if err != nil || envelope.AggregateID != "a1" {
+			t.Fatalf("published envelope %+v, err %v", envelope, err)
+		}
+		versions[envelope.AggregateVersion] = true
+	}
+	if !versions[1] || !versions[2] {
+		t.Fatalf("published versions %v, expected 1 and 2", versions)
+	}
+}
@@ -0,0 +1,474 @@
+package event
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+const (
+	archiveIndexFile = "index.json"
+	archiveDayLayout = "2006-01-02"
+	archiveExt       = ".jsonl"
+	archiveGzipExt   = ".jsonl.gz"
+)
+
+//ArchiveSegment archive file of one subject and day with its sequence and time range
+type ArchiveSegment struct {
+	File           string `json:"file"`
+	FirstSequence  uint64 `json:"first_sequence"`
+	LastSequence   uint64 `json:"last_sequence"`
+	FirstTimestamp int64  `json:"first_timestamp"`
+	LastTimestamp  int64  `json:"last_timestamp"`
+	Count          int    `json:"count"`
+}
+
+func (s *ArchiveSegment) add(record Record) {
+	s.merge(ArchiveSegment{
+		FirstSequence:  record.Sequence,
+		LastSequence:   record.Sequence,
+		FirstTimestamp: record.Timestamp,
+		LastTimestamp:  record.Timestamp,
+		Count:          1,
+	})
+}
+
+func (s *ArchiveSegment) merge(o ArchiveSegment) {
+	if o.Count == 0 {
+		return
+	}
+	if s.Count == 0 || o.FirstSequence < s.FirstSequence {
+		s.FirstSequence = o.FirstSequence
+	}
+	if o.LastSequence > s.LastSequence {
+		s.LastSequence = o.LastSequence
+	}
+	if s.Count == 0 || o.FirstTimestamp < s.FirstTimestamp {
+		s.FirstTimestamp = o.FirstTimestamp
+	}
+	if o.LastTimestamp > s.LastTimestamp {
+		s.LastTimestamp = o.LastTimestamp
+	}
+	s.Count += o.Count
+}
+
+//overlaps return true when segment may contain messages within sequence and time range of filter
+func (s ArchiveSegment) overlaps(filter ReplayFilter) bool {
+	return (filter.FromSequence == 0 || s.LastSequence >= filter.FromSequence) &&
+		(filter.ToSequence == 0 || s.FirstSequence <= filter.ToSequence) &&
+		(filter.FromTime.IsZero() || s.LastTimestamp >= filter.FromTime.UnixNano()) &&
+		(filter.ToTime.IsZero() || s.FirstTimestamp <= filter.ToTime.UnixNano())
+}
+
+//Archiver subscribe subjects and write envelopes into jsonl files partitioned by subject and day of publish time.
+//Day file is written as dir/<subject>/<day>.jsonl and compressed into <day>.jsonl.gz when a later day starts or archiver stops,
+//sealed files are listed with their sequence range in dir/<subject>/index.json.
+type Archiver struct {
+	broker  Broker
+	dir     string
+	logger  log.Logger
+	durable string
+	start   StartPosition
+
+	mu   sync.Mutex
+	subs []Subscription
+	open map[string]*archiveFile
+}
+
+type archiveFile struct {
+	subject string
+	day     string
+	f       *os.File
+	segment ArchiveSegment
+}
+
+//ArchiverOption sets optional parameter of Archiver
+type ArchiverOption func(*Archiver)
+
+//ArchiverDurable subscribe subjects with durable name, restarted archiver resumes after the last archived message
+func ArchiverDurable(durable string) ArchiverOption {
+	return func(a *Archiver) { a.durable = durable }
+}
+
+//ArchiverStart sets start position of new subscription, default is all available messages
+func ArchiverStart(start StartPosition) ArchiverOption {
+	return func(a *Archiver) { a.start = start }
+}
+
+//NewArchiver create archiver writing into directory
+func NewArchiver(broker Broker, dir string, logger log.Logger, opts ...ArchiverOption) *Archiver {
+	a := &Archiver{
+		broker: broker,
+		dir:    dir,
+		logger: logger,
+		start:  StartPosition{Kind: StartAll},
+		open:   make(map[string]*archiveFile),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+//Start subscribe subjects, message is acknowledged after it is written into archive file
+func (a *Archiver) Start(subjects ...string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, subject := range subjects {
+		sub, err := a.broker.Subscribe(subject, a.handle, SubscribeOptions{
+			Durable:   a.durable,
+			Start:     a.start,
+			ManualAck: true,
+		})
+		if err != nil {
+			return err
+		}
+		a.subs = append(a.subs, sub)
+		a.logger.Log("archiver", fmt.Sprintf("Archiving topic %s into %s", subject, a.dir))
+	}
+	return nil
+}
+
+//Stop close subscriptions keeping durable interest and seal every open file
+func (a *Archiver) Stop() error {
+	a.mu.Lock()
+	subs := a.subs
+	a.subs = nil
+	a.mu.Unlock()
+
+	var firstErr error
+	for _, sub := range subs {
+		if err := sub.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, file := range a.open {
+		if err := a.seal(file); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(a.open, key)
+	}
+	return firstErr
+}
+
+func (a *Archiver) handle(msg *Msg) {
+	if err := a.write(NewRecord(msg)); err != nil {
+		a.logger.Log("archiver", fmt.Sprintf("Error when archiving sequence %d of topic %s", msg.Sequence, msg.Subject), "err", err)
+		return
+	}
+	if err := msg.Ack(); err != nil {
+		a.logger.Log("archiver", fmt.Sprintf("Error when acknowledging sequence %d of topic %s", msg.Sequence, msg.Subject), "err", err)
+	}
+}
+
+func (a *Archiver) write(record Record) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	day := time.Unix(0, record.Timestamp).UTC().Format(archiveDayLayout)
+	for key, file := range a.open {
+		if file.subject == record.Subject && file.day < day {
+			if err := a.seal(file); err != nil {
+				return err
+			}
+			delete(a.open, key)
+		}
+	}
+
+	key := record.Subject + "/" + day
+	file, ok := a.open[key]
+	if !ok {
+		var err error
+		if file, err = a.openFile(record.Subject, day); err != nil {
+			return err
+		}
+		a.open[key] = file
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err = file.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	//record must be durable before message is acknowledged
+	if err = file.f.Sync(); err != nil {
+		return err
+	}
+	file.segment.add(record)
+	return nil
+}
+
+//openFile open day file for appending, records left by previous run are counted into its segment
+func (a *Archiver) openFile(subject, day string) (*archiveFile, error) {
+	dir := filepath.Join(a.dir, subject)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, day+archiveExt)
+	file := &archiveFile{subject: subject, day: day}
+	if err := readArchiveFile(path, func(record Record) error {
+		file.segment.add(record)
+		return nil
+	}); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	//drop incomplete line written before a crash
+	data, err := io.ReadAll(f)
+	if err == nil {
+		err = f.Truncate(int64(bytes.LastIndexByte(data, '\n') + 1))
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekEnd)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	file.f = f
+	return file, nil
+}
+
+//seal compress day file together with gzip file of the day into a temporary file renamed over the gzip file,
+//then record its range in subject index and remove day file.
+//Records are deduplicated by sequence, so day file left by a crash after rename is sealed again without duplicates.
+func (a *Archiver) seal(file *archiveFile) error {
+	if err := file.f.Close(); err != nil {
+		return err
+	}
+	dir := filepath.Join(a.dir, file.subject)
+	plain := filepath.Join(dir, file.day+archiveExt)
+	if file.segment.Count > 0 {
+		sealed := filepath.Join(dir, file.day+archiveGzipExt)
+		segment, err := mergeGzip(sealed, plain)
+		if err != nil {
+			return err
+		}
+		if err = updateArchiveIndex(dir, file.day+archiveGzipExt, segment); err != nil {
+			return err
+		}
+	}
+	return os.Remove(plain)
+}
+
+//mergeGzip write records of gzip file and day file into gzip file, returns range of the merged file
+func mergeGzip(path, source string) (ArchiveSegment, error) {
+	var segment ArchiveSegment
+	tmp := path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return segment, err
+	}
+	defer os.Remove(tmp)
+	gz := gzip.NewWriter(out)
+	w := bufio.NewWriter(gz)
+	seen := make(map[uint64]bool)
+	write := func(record Record) error {
+		if seen[record.Sequence] {
+			return nil
+		}
+		seen[record.Sequence] = true
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		segment.add(record)
+		return nil
+	}
+	if err = readArchiveFile(path, write); err != nil && !os.IsNotExist(err) {
+		out.Close()
+		return segment, err
+	}
+	if err = readArchiveFile(source, write); err != nil {
+		out.Close()
+		return segment, err
+	}
+	if err = w.Flush(); err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if err != nil {
+		out.Close()
+		return segment, err
+	}
+	if err = out.Close(); err != nil {
+		return segment, err
+	}
+	return segment, os.Rename(tmp, path)
+}
+
+//ReadArchiveIndex return sealed segments of subject archived in directory ordered by day
+func ReadArchiveIndex(dir, subject string) ([]ArchiveSegment, error) {
+	data, err := os.ReadFile(filepath.Join(dir, subject, archiveIndexFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var segments []ArchiveSegment
+	if err = json.Unmarshal(data, &segments); err != nil {
+		return nil, err
+	}
+	return segments, nil
+}
+
+//updateArchiveIndex set range of sealed file in subject index, index is replaced through a temporary file
+func updateArchiveIndex(dir, name string, segment ArchiveSegment) error {
+	segments, err := ReadArchiveIndex(filepath.Dir(dir), filepath.Base(dir))
+	if err != nil {
+		return err
+	}
+	segment.File = name
+	found := false
+	for i := range segments {
+		if segments[i].File == name {
+			segments[i] = segment
+			found = true
+		}
+	}
+	if !found {
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].File < segments[j].File })
+
+	data, err := json.MarshalIndent(segments, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, archiveIndexFile+".tmp")
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, archiveIndexFile))
+}
+
+//RestoreArchive write archived records of subject matching filter into sink, day by day.
+//Sealed files outside of filter range are skipped using the index, unsealed files are always read.
+//Record archived more than once (ex: redelivered message) is written once.
+//Use NewSubjectSink to republish records or NewProjectionSink to feed them into a projection.
+func RestoreArchive(ctx context.Context, dir, subject string, filter ReplayFilter, sink ReplaySink) (ReplayStats, error) {
+	var stats ReplayStats
+	segments, err := ReadArchiveIndex(dir, subject)
+	if err != nil {
+		return stats, err
+	}
+	var files []string
+	for _, segment := range segments {
+		if segment.overlaps(filter) {
+			files = append(files, segment.File)
+		}
+	}
+	unsealed, err := filepath.Glob(filepath.Join(dir, subject, "*"+archiveExt))
+	if err != nil {
+		return stats, err
+	}
+	for _, path := range unsealed {
+		files = append(files, filepath.Base(path))
+	}
+	//sealed records of a day are older than unsealed records of the same day
+	sort.Slice(files, func(i, j int) bool { return archiveOrder(files[i]) < archiveOrder(files[j]) })
+
+	seen := make(map[uint64]bool)
+	for _, file := range files {
+		err := readArchiveFile(filepath.Join(dir, subject, file), func(record Record) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if seen[record.Sequence] {
+				return nil
+			}
+			seen[record.Sequence] = true
+			msg := &Msg{Subject: record.Subject, Sequence: record.Sequence, Timestamp: record.Timestamp}
+			if record.Sequence < filter.FromSequence || (!filter.FromTime.IsZero() && record.Timestamp < filter.FromTime.UnixNano()) || filter.Done(msg) {
+				return nil
+			}
+			stats.Received++
+			envelope, err := UnmarshalEnvelope(record.Envelope)
+			if err != nil {
+				stats.Invalid++
+				return nil
+			}
+			if !filter.Match(envelope) {
+				stats.Skipped++
+				return nil
+			}
+			if err = sink.Write(record); err != nil {
+				return err
+			}
+			stats.Replayed++
+			return nil
+		})
+		if err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+func archiveOrder(name string) string {
+	if strings.HasSuffix(name, archiveGzipExt) {
+		return strings.TrimSuffix(name, archiveGzipExt) + "0"
+	}
+	return strings.TrimSuffix(name, archiveExt) + "1"
+}
+
+//readArchiveFile call f for every record of jsonl or gzip compressed jsonl file, incomplete last line is ignored
+func readArchiveFile(path string, f func(record Record) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var record Record
+		if err = json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("invalid archive record in %s: %v", path, err)
+		}
+		if err = f(record); err != nil {
+			return err
+		}
+	}
+}
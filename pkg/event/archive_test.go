@@ -0,0 +1,171 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+//recordSink collect sequences of written records
+type recordSink struct {
+	sequences []uint64
+}
+
+func (s *recordSink) Write(record Record) error {
+	s.sequences = append(s.sequences, record.Sequence)
+	return nil
+}
+
+func (s *recordSink) Close() error { return nil }
+
+var archiveDay = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+func archiveRecord(sequence uint64, day int) Record {
+	return Record{
+		Subject:   "account",
+		Sequence:  sequence,
+		Timestamp: archiveDay.AddDate(0, 0, day).Add(time.Duration(sequence) * time.Second).UnixNano(),
+		Envelope:  json.RawMessage(`{"status":"commit","event_type":"create","data":{}}`),
+	}
+}
+
+func archive(t *testing.T, archiver *Archiver, records ...Record) {
+	t.Helper()
+	for _, record := range records {
+		if err := archiver.write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func restore(t *testing.T, dir string, filter ReplayFilter) []uint64 {
+	t.Helper()
+	sink := &recordSink{}
+	if _, err := RestoreArchive(context.Background(), dir, "account", filter, sink); err != nil {
+		t.Fatal(err)
+	}
+	return sink.sequences
+}
+
+func TestArchiveSealRestore(t *testing.T) {
+	dir := t.TempDir()
+	archiver := NewArchiver(NewMemoryBroker(), dir, log.NewNopLogger())
+	//later day seals the first one, sequence 3 is archived twice as redelivered message
+	archive(t, archiver, archiveRecord(1, 0), archiveRecord(2, 0), archiveRecord(3, 1), archiveRecord(3, 1))
+	if _, err := os.Stat(filepath.Join(dir, "account", "2024-03-01"+archiveGzipExt)); err != nil {
+		t.Fatalf("first day is not sealed when later day starts, %v", err)
+	}
+	if err := archiver.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := ReadArchiveIndex(dir, "account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ArchiveSegment{
+		{File: "2024-03-01" + archiveGzipExt, FirstSequence: 1, LastSequence: 2, FirstTimestamp: archiveRecord(1, 0).Timestamp, LastTimestamp: archiveRecord(2, 0).Timestamp, Count: 2},
+		{File: "2024-03-02" + archiveGzipExt, FirstSequence: 3, LastSequence: 3, FirstTimestamp: archiveRecord(3, 1).Timestamp, LastTimestamp: archiveRecord(3, 1).Timestamp, Count: 1},
+	}
+	if fmt.Sprint(segments) != fmt.Sprint(expected) {
+		t.Fatalf("index %+v, expected %+v", segments, expected)
+	}
+	if unsealed, _ := filepath.Glob(filepath.Join(dir, "account", "*"+archiveExt)); len(unsealed) != 0 {
+		t.Fatalf("day files %v are left after stop", unsealed)
+	}
+
+	tests := []struct {
+		name     string
+		filter   ReplayFilter
+		expected string
+	}{
+		{name: "all", expected: "[1 2 3]"},
+		{name: "from sequence", filter: ReplayFilter{FromSequence: 2}, expected: "[2 3]"},
+		{name: "to time", filter: ReplayFilter{ToTime: archiveDay.Add(12 * time.Hour)}, expected: "[1 2]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if sequences := restore(t, dir, test.filter); fmt.Sprint(sequences) != test.expected {
+				t.Fatalf("restored %v, expected %s", sequences, test.expected)
+			}
+		})
+	}
+}
+
+func TestArchiveResealAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	archiver := NewArchiver(NewMemoryBroker(), dir, log.NewNopLogger())
+	archive(t, archiver, archiveRecord(1, 0), archiveRecord(2, 0))
+	if err := archiver.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	//crash after sealed file is renamed leaves day file behind, it is followed by a record written after it
+	plain := filepath.Join(dir, "account", "2024-03-01"+archiveExt)
+	var data []byte
+	for _, record := range []Record{archiveRecord(2, 0), archiveRecord(3, 0)} {
+		line, _ := json.Marshal(record)
+		data = append(data, append(line, '\n')...)
+	}
+	if err := os.WriteFile(plain, append(data, `{"subject":"acc`...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if sequences := restore(t, dir, ReplayFilter{}); fmt.Sprint(sequences) != "[1 2 3]" {
+		t.Fatalf("restored %v before sealing again", sequences)
+	}
+
+	archiver = NewArchiver(NewMemoryBroker(), dir, log.NewNopLogger())
+	archive(t, archiver, archiveRecord(4, 0))
+	if err := archiver.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	segments, err := ReadArchiveIndex(dir, "account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 || segments[0].Count != 4 || segments[0].FirstSequence != 1 || segments[0].LastSequence != 4 {
+		t.Fatalf("index %+v, expected sequences 1 to 4", segments)
+	}
+	var sealed []uint64
+	if err = readArchiveFile(filepath.Join(dir, "account", "2024-03-01"+archiveGzipExt), func(record Record) error {
+		sealed = append(sealed, record.Sequence)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(sealed) != "[1 2 3 4]" {
+		t.Fatalf("sealed %v, expected every record once", sealed)
+	}
+	if _, err = os.Stat(plain + ".tmp"); !os.IsNotExist(err) {
+		t.Fatal("temporary file is left after sealing")
+	}
+}
+
+func TestArchiverStart(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	for i := 0; i < 3; i++ {
+		broker.Publish("account", []byte(`{"status":"commit","data":{}}`))
+	}
+	dir := t.TempDir()
+	archiver := NewArchiver(broker, dir, log.NewNopLogger(), ArchiverDurable("archiver"))
+	if err := archiver.Start("account"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		stats, err := RestoreArchive(context.Background(), dir, "account", ReplayFilter{}, &recordSink{})
+		return err == nil && stats.Replayed == 3
+	})
+	if err := archiver.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if sequences := restore(t, dir, ReplayFilter{}); fmt.Sprint(sequences) != "[1 2 3]" {
+		t.Fatalf("restored %v", sequences)
+	}
+}
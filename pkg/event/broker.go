@@ -0,0 +1,133 @@
+package event
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Msg message delivered by broker
+type Msg struct {
+	Subject         string
+	Sequence        uint64
+	Data            []byte
+	Timestamp       int64
+	Redelivered     bool
+	RedeliveryCount uint32
+
+	ack func() error
+	raw interface{}
+	err error
+}
+
+//NewMsg create message delivered by broker adapter, ack is called by Ack and may be nil when subscription is not in manual ack mode
+func NewMsg(subject string, sequence uint64, data []byte, ack func() error) *Msg {
+	return &Msg{
+		Subject:   subject,
+		Sequence:  sequence,
+		Data:      data,
+		Timestamp: time.Now().UnixNano(),
+		ack:       ack,
+	}
+}
+
+//Err return error reported by handler built with Handle
+func (m *Msg) Err() error {
+	return m.err
+}
+
+//Ack acknowledge message, no-op when subscription is not in manual ack mode
+func (m *Msg) Ack() error {
+	if m.ack == nil {
+		return nil
+	}
+	return m.ack()
+}
+
+//MsgHandler handles message delivered by broker
+type MsgHandler func(msg *Msg)
+
+//StartKind kind of subscription start position
+type StartKind int
+
+const (
+	//StartNew deliver only new messages
+	StartNew StartKind = iota
+	//StartAll deliver all available messages
+	StartAll
+	//StartLast deliver starting from last received message
+	StartLast
+	//StartSequence deliver starting from sequence
+	StartSequence
+	//StartTime deliver starting from time
+	StartTime
+)
+
+//StartPosition position where new subscription starts receiving messages
+type StartPosition struct {
+	Kind     StartKind
+	Sequence uint64
+	Time     time.Time
+}
+
+//ParseStartAt parse start option (new, all, last, seqno:100, time:1559291755, since:2h) into StartPosition
+func ParseStartAt(startAt string) (StartPosition, error) {
+	var option = strings.SplitN(startAt, ":", 2)
+	switch option[0] {
+	case "", "new":
+		return StartPosition{Kind: StartNew}, nil
+	case "all":
+		return StartPosition{Kind: StartAll}, nil
+	case "last":
+		return StartPosition{Kind: StartLast}, nil
+	}
+	if len(option) != 2 {
+		return StartPosition{}, fmt.Errorf("invalid start option %s", startAt)
+	}
+	switch option[0] {
+	case "seqno":
+		intSeq, err := strconv.ParseUint(option[1], 10, 64)
+		if err != nil {
+			return StartPosition{}, err
+		}
+		return StartPosition{Kind: StartSequence, Sequence: intSeq}, nil
+	case "time":
+		intTimestamp, err := strconv.ParseInt(option[1], 10, 64)
+		if err != nil {
+			return StartPosition{}, err
+		}
+		return StartPosition{Kind: StartTime, Time: time.Unix(intTimestamp, 0)}, nil
+	case "since":
+		ago, err := time.ParseDuration(option[1])
+		if err != nil {
+			return StartPosition{}, err
+		}
+		return StartPosition{Kind: StartTime, Time: time.Now().Add(-ago)}, nil
+	}
+	return StartPosition{}, fmt.Errorf("invalid start option %s", startAt)
+}
+
+//SubscribeOptions options of broker subscription
+type SubscribeOptions struct {
+	QueueGroup  string
+	Durable     string
+	Start       StartPosition
+	ManualAck   bool
+	AckWait     time.Duration
+	MaxInflight int
+}
+
+//Subscription subscription created by broker
+type Subscription interface {
+	//Unsubscribe remove subscription including its durable state
+	Unsubscribe() error
+	//Close close subscription keeping its durable state
+	Close() error
+}
+
+//Broker publish and subscribe messages
+type Broker interface {
+	Publish(subject string, data []byte) error
+	Subscribe(subject string, handler MsgHandler, opts SubscribeOptions) (Subscription, error)
+}
@@ -0,0 +1,153 @@
+package event
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+//jetStreamInactiveThreshold removes consumer of non durable queue group after its last member is gone
+const jetStreamInactiveThreshold = time.Minute
+
+type jetStreamBroker struct {
+	js     jetstream.JetStream
+	stream string
+}
+
+type jetStreamSubscription struct {
+	consume jetstream.ConsumeContext
+	js      jetstream.JetStream
+	stream  string
+	name    string
+	shared  bool
+}
+
+//NewJetStreamBroker create broker backed by nats jetstream, subjects must be captured by stream
+func NewJetStreamBroker(js jetstream.JetStream, stream string) Broker {
+	return &jetStreamBroker{js: js, stream: stream}
+}
+
+func (b *jetStreamBroker) Publish(subject string, data []byte) error {
+	_, err := b.js.Publish(context.Background(), subject, data)
+	return err
+}
+
+//Subscribe bind queue group and durable of subject to a durable consumer, existing durable consumer resumes regardless of start position.
+//Durable is scoped per subject like nats streaming durable.
+func (b *jetStreamBroker) Subscribe(subject string, handler MsgHandler, opts SubscribeOptions) (Subscription, error) {
+	ctx := context.Background()
+	name := jetStreamConsumerName(subject, opts.QueueGroup, opts.Durable)
+
+	var consumer jetstream.Consumer
+	var err error
+	if name != "" {
+		consumer, err = b.js.Consumer(ctx, b.stream, name)
+		if err == nil && consumer.CachedInfo().Config.FilterSubject != subject {
+			return nil, fmt.Errorf("jetstream consumer %s of stream %s filters subject %s, not %s", name, b.stream, consumer.CachedInfo().Config.FilterSubject, subject)
+		}
+	}
+	if name == "" || errors.Is(err, jetstream.ErrConsumerNotFound) {
+		consumer, err = b.js.CreateConsumer(ctx, b.stream, jetStreamConsumerConfig(subject, name, opts))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	consume, err := consumer.Consume(func(m jetstream.Msg) {
+		msg := &Msg{
+			Subject: m.Subject(),
+			Data:    m.Data(),
+			raw:     m,
+		}
+		if opts.ManualAck {
+			msg.ack = m.Ack
+		}
+		if meta, err := m.Metadata(); err == nil {
+			msg.Sequence = meta.Sequence.Stream
+			msg.Timestamp = meta.Timestamp.UnixNano()
+			msg.Redelivered = meta.NumDelivered > 1
+			msg.RedeliveryCount = uint32(meta.NumDelivered - 1)
+		}
+		handler(msg)
+		if !opts.ManualAck {
+			m.Ack()
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &jetStreamSubscription{
+		consume: consume,
+		js:      b.js,
+		stream:  b.stream,
+		name:    name,
+		shared:  opts.QueueGroup != "",
+	}, nil
+}
+
+func jetStreamConsumerConfig(subject, name string, opts SubscribeOptions) jetstream.ConsumerConfig {
+	cfg := jetstream.ConsumerConfig{
+		Durable:       name,
+		FilterSubject: subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       opts.AckWait,
+		MaxAckPending: opts.MaxInflight,
+	}
+	if name != "" && opts.Durable == "" {
+		cfg.InactiveThreshold = jetStreamInactiveThreshold
+	}
+	switch opts.Start.Kind {
+	case StartNew:
+		cfg.DeliverPolicy = jetstream.DeliverNewPolicy
+	case StartAll:
+		cfg.DeliverPolicy = jetstream.DeliverAllPolicy
+	case StartLast:
+		cfg.DeliverPolicy = jetstream.DeliverLastPolicy
+	case StartSequence:
+		cfg.DeliverPolicy = jetstream.DeliverByStartSequencePolicy
+		cfg.OptStartSeq = opts.Start.Sequence
+	case StartTime:
+		start := opts.Start.Time
+		cfg.DeliverPolicy = jetstream.DeliverByStartTimePolicy
+		cfg.OptStartTime = &start
+	}
+	return cfg
+}
+
+//jetStreamConsumerName build durable consumer name from queue group, durable name and subject, empty without group and durable.
+//Readable prefix is sanitized, so it is suffixed by hash of the original tuple to keep names of different tuples apart.
+func jetStreamConsumerName(subject, group, durable string) string {
+	if group == "" && durable == "" {
+		return ""
+	}
+	var parts []string
+	for _, part := range []string{group, durable, subject} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	sum := sha256.Sum256([]byte(group + "\x00" + durable + "\x00" + subject))
+	parts = append(parts, hex.EncodeToString(sum[:8]))
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_", "/", "_").Replace(strings.Join(parts, "_"))
+}
+
+//Unsubscribe stop consuming and delete durable consumer, consumer shared by queue group is kept for remaining members
+func (s *jetStreamSubscription) Unsubscribe() error {
+	s.consume.Stop()
+	if s.name == "" || s.shared {
+		return nil
+	}
+	return s.js.DeleteConsumer(context.Background(), s.stream, s.name)
+}
+
+//Close stop consuming keeping durable consumer
+func (s *jetStreamSubscription) Close() error {
+	s.consume.Stop()
+	return nil
+}
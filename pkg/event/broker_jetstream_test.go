@@ -0,0 +1,169 @@
+package event
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+//runJetStream start embedded nats server with jetstream and create stream capturing subjects
+func runJetStream(t *testing.T, subjects ...string) jetstream.JetStream {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir(), NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server is not ready")
+	}
+	t.Cleanup(srv.Shutdown)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "EVENTS", Subjects: subjects}); err != nil {
+		t.Fatal(err)
+	}
+	return js
+}
+
+func TestJetStreamBrokerPublishSubscribe(t *testing.T) {
+	broker := NewJetStreamBroker(runJetStream(t, "account"), "EVENTS")
+	if err := broker.Publish("account", []byte(`{"n":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	sub, received := collect(t, broker, "account", SubscribeOptions{Start: StartPosition{Kind: StartAll}})
+	defer sub.Unsubscribe()
+
+	msg := receive(t, received)
+	if string(msg.Data) != `{"n":1}` || msg.Subject != "account" || msg.Sequence != 1 || msg.Timestamp == 0 {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+}
+
+func TestJetStreamBrokerDurablePerSubject(t *testing.T) {
+	broker := NewJetStreamBroker(runJetStream(t, "account", "payment"), "EVENTS")
+	opts := SubscribeOptions{Durable: "archiver", Start: StartPosition{Kind: StartAll}}
+	account, accounts := collect(t, broker, "account", opts)
+	payment, payments := collect(t, broker, "payment", opts)
+
+	broker.Publish("account", []byte("a1"))
+	broker.Publish("payment", []byte("p1"))
+	if msg := receive(t, accounts); string(msg.Data) != "a1" {
+		t.Fatalf("account durable received %s", msg.Data)
+	}
+	if msg := receive(t, payments); string(msg.Data) != "p1" {
+		t.Fatalf("payment durable received %s", msg.Data)
+	}
+	expectNone(t, accounts)
+	expectNone(t, payments)
+
+	//closed durable resumes after the last acknowledged message
+	account.Close()
+	payment.Close()
+	broker.Publish("account", []byte("a2"))
+	account, accounts = collect(t, broker, "account", opts)
+	defer account.Unsubscribe()
+	if msg := receive(t, accounts); string(msg.Data) != "a2" {
+		t.Fatalf("resumed durable received %s", msg.Data)
+	}
+	expectNone(t, accounts)
+}
+
+func TestJetStreamConsumerName(t *testing.T) {
+	tuples := [][3]string{
+		{"a.b", "", "archiver"},
+		{"a_b", "", "archiver"},
+		{"a", "", "b_archiver"},
+		{"a", "b", "archiver"},
+		{"a", "b.archiver", ""},
+	}
+	names := make(map[string][3]string)
+	for _, tuple := range tuples {
+		name := jetStreamConsumerName(tuple[0], tuple[1], tuple[2])
+		if previous, ok := names[name]; ok {
+			t.Fatalf("%v and %v share consumer %s", previous, tuple, name)
+		}
+		names[name] = tuple
+	}
+	if name := jetStreamConsumerName("a", "", ""); name != "" {
+		t.Fatalf("ephemeral subscription is named %s", name)
+	}
+}
+
+func TestJetStreamBrokerConsumerSubjectMismatch(t *testing.T) {
+	js := runJetStream(t, "account", "payment")
+	name := jetStreamConsumerName("account", "", "archiver")
+	if _, err := js.CreateConsumer(context.Background(), "EVENTS", jetstream.ConsumerConfig{Durable: name, FilterSubject: "payment", AckPolicy: jetstream.AckExplicitPolicy}); err != nil {
+		t.Fatal(err)
+	}
+	broker := NewJetStreamBroker(js, "EVENTS")
+	if _, err := broker.Subscribe("account", func(*Msg) {}, SubscribeOptions{Durable: "archiver"}); err == nil {
+		t.Fatal("consumer filtering another subject is reused")
+	}
+}
+
+func TestJetStreamBrokerRedelivery(t *testing.T) {
+	broker := NewJetStreamBroker(runJetStream(t, "account"), "EVENTS")
+	var once sync.Once
+	received := make(chan *Msg, 10)
+	sub, err := broker.Subscribe("account", func(msg *Msg) {
+		received <- msg
+		first := false
+		once.Do(func() { first = true })
+		if !first {
+			msg.Ack()
+		}
+	}, SubscribeOptions{ManualAck: true, AckWait: 500 * time.Millisecond, Start: StartPosition{Kind: StartAll}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	broker.Publish("account", []byte("a1"))
+	if msg := receive(t, received); msg.Redelivered {
+		t.Fatal("first delivery is marked redelivered")
+	}
+	msg := receive(t, received)
+	if !msg.Redelivered || msg.RedeliveryCount != 1 || string(msg.Data) != "a1" {
+		t.Fatalf("unexpected redelivery %+v", msg)
+	}
+	expectNone(t, received)
+}
+
+func TestJetStreamBrokerQueueGroup(t *testing.T) {
+	broker := NewJetStreamBroker(runJetStream(t, "account"), "EVENTS")
+	opts := SubscribeOptions{QueueGroup: "workers", Start: StartPosition{Kind: StartAll}}
+	first, received := collect(t, broker, "account", opts)
+	defer first.Unsubscribe()
+	second, err := broker.Subscribe("account", func(msg *Msg) { received <- msg }, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Unsubscribe()
+
+	for i := 0; i < 10; i++ {
+		broker.Publish("account", []byte{byte('0' + i)})
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		msg := receive(t, received)
+		if seen[string(msg.Data)] {
+			t.Fatalf("message %s is delivered to more than one member", msg.Data)
+		}
+		seen[string(msg.Data)] = true
+	}
+	expectNone(t, received)
+}
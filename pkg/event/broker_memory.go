@@ -0,0 +1,406 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMemoryAckWait     = 30 * time.Second
+	defaultMemoryMaxInflight = 1024
+)
+
+var errMemoryBrokerClosed = errors.New("memory broker closed")
+
+//MemoryBroker in-process broker for running event flows without nats streaming server.
+//It supports queue groups, durable subscriptions, start positions and redelivery of unacknowledged messages.
+type MemoryBroker struct {
+	mu        sync.Mutex
+	channels  map[string][]Msg
+	consumers map[string]*memoryConsumer
+	active    map[string]map[*memoryConsumer]struct{}
+	closed    bool
+}
+
+//memoryConsumer delivery state shared by members of a queue group or durable subscription
+type memoryConsumer struct {
+	broker  *MemoryBroker
+	subject string
+	key     string
+	durable bool
+	next    uint64
+	pending map[uint64]*memoryPending
+	members []*memorySubscription
+	rr      int
+	notify  chan struct{}
+	stop    chan struct{}
+}
+
+type memoryPending struct {
+	member   *memorySubscription
+	deadline time.Time
+	count    uint32
+}
+
+type memorySubscription struct {
+	consumer *memoryConsumer
+	handler  MsgHandler
+	opts     SubscribeOptions
+	inflight int
+	queue    []*Msg
+	signal   chan struct{}
+	closed   bool
+}
+
+//NewMemoryBroker create in-process broker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		channels:  make(map[string][]Msg),
+		consumers: make(map[string]*memoryConsumer),
+		active:    make(map[string]map[*memoryConsumer]struct{}),
+	}
+}
+
+//Publish store message in subject channel and deliver it to subscriptions
+func (b *MemoryBroker) Publish(subject string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return errMemoryBrokerClosed
+	}
+	payload := make([]byte, len(data))
+	copy(payload, data)
+	b.channels[subject] = append(b.channels[subject], Msg{
+		Subject:   subject,
+		Sequence:  uint64(len(b.channels[subject]) + 1),
+		Data:      payload,
+		Timestamp: time.Now().UnixNano(),
+	})
+	for c := range b.active[subject] {
+		wake(c.notify)
+	}
+	return nil
+}
+
+//Messages return all messages stored in subject channel
+func (b *MemoryBroker) Messages(subject string) []Msg {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]Msg(nil), b.channels[subject]...)
+}
+
+//Subscribe subscribe subject with options
+func (b *MemoryBroker) Subscribe(subject string, handler MsgHandler, opts SubscribeOptions) (Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, errMemoryBrokerClosed
+	}
+	if opts.AckWait <= 0 {
+		opts.AckWait = defaultMemoryAckWait
+	}
+	if opts.MaxInflight <= 0 {
+		opts.MaxInflight = defaultMemoryMaxInflight
+	}
+
+	key := memoryConsumerKey(subject, opts)
+	c := b.consumers[key]
+	if key != "" && c != nil && opts.QueueGroup == "" && len(c.members) > 0 {
+		return nil, fmt.Errorf("duplicate durable registration %s on subject %s", opts.Durable, subject)
+	}
+	if c == nil {
+		c = &memoryConsumer{
+			broker:  b,
+			subject: subject,
+			key:     key,
+			durable: opts.Durable != "",
+			next:    b.startSequence(subject, opts.Start),
+			pending: make(map[uint64]*memoryPending),
+		}
+		if key != "" {
+			b.consumers[key] = c
+		}
+	}
+	if len(c.members) == 0 {
+		c.notify = make(chan struct{}, 1)
+		c.stop = make(chan struct{})
+		if b.active[subject] == nil {
+			b.active[subject] = make(map[*memoryConsumer]struct{})
+		}
+		b.active[subject][c] = struct{}{}
+		go c.run(c.notify, c.stop)
+	}
+
+	s := &memorySubscription{
+		consumer: c,
+		handler:  handler,
+		opts:     opts,
+		signal:   make(chan struct{}, 1),
+	}
+	c.members = append(c.members, s)
+	go s.run()
+	wake(c.notify)
+	return s, nil
+}
+
+//Close stop all subscriptions, published messages are discarded
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for _, consumers := range b.active {
+		for c := range consumers {
+			for _, s := range c.members {
+				s.close()
+			}
+			c.members = nil
+			close(c.stop)
+		}
+	}
+	b.active = make(map[string]map[*memoryConsumer]struct{})
+	return nil
+}
+
+func memoryConsumerKey(subject string, opts SubscribeOptions) string {
+	if opts.QueueGroup != "" {
+		return fmt.Sprintf("queue|%s|%s|%s", subject, opts.QueueGroup, opts.Durable)
+	}
+	if opts.Durable != "" {
+		return fmt.Sprintf("durable|%s|%s", subject, opts.Durable)
+	}
+	return ""
+}
+
+func (b *MemoryBroker) startSequence(subject string, start StartPosition) uint64 {
+	channel := b.channels[subject]
+	last := uint64(len(channel))
+	switch start.Kind {
+	case StartAll:
+		return 1
+	case StartLast:
+		if last == 0 {
+			return 1
+		}
+		return last
+	case StartSequence:
+		if start.Sequence == 0 {
+			return 1
+		}
+		return start.Sequence
+	case StartTime:
+		ts := start.Time.UnixNano()
+		idx := sort.Search(len(channel), func(i int) bool { return channel[i].Timestamp >= ts })
+		return uint64(idx + 1)
+	}
+	return last + 1
+}
+
+func (b *MemoryBroker) remove(s *memorySubscription, keepDurable bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.close()
+
+	c := s.consumer
+	for i, member := range c.members {
+		if member == s {
+			c.members = append(c.members[:i], c.members[i+1:]...)
+			break
+		}
+	}
+	for _, p := range c.pending {
+		if p.member == s {
+			p.member = nil
+			p.deadline = time.Time{}
+		}
+	}
+	if len(c.members) > 0 {
+		wake(c.notify)
+		return nil
+	}
+
+	close(c.stop)
+	delete(b.active[c.subject], c)
+	if !c.durable || !keepDurable {
+		delete(b.consumers, c.key)
+	}
+	return nil
+}
+
+//wake signal consumer loop, notify channel of consumer must be read while holding broker lock
+func wake(notify chan struct{}) {
+	select {
+	case notify <- struct{}{}:
+	default:
+	}
+}
+
+func (c *memoryConsumer) run(notify <-chan struct{}, stop <-chan struct{}) {
+	for {
+		var timeout <-chan time.Time
+		if wait := c.dispatch(); wait > 0 {
+			timeout = time.After(wait)
+		}
+		select {
+		case <-stop:
+			return
+		case <-notify:
+		case <-timeout:
+		}
+	}
+}
+
+//dispatch deliver due redeliveries and new messages, returns duration until next redelivery
+func (c *memoryConsumer) dispatch() time.Duration {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(c.members) == 0 {
+		return 0
+	}
+	now := time.Now()
+	channel := b.channels[c.subject]
+
+	sequences := make([]uint64, 0, len(c.pending))
+	for seq := range c.pending {
+		sequences = append(sequences, seq)
+	}
+	sort.Slice(sequences, func(i, j int) bool { return sequences[i] < sequences[j] })
+	for _, seq := range sequences {
+		p := c.pending[seq]
+		if p.deadline.After(now) {
+			continue
+		}
+		member := p.member
+		if member == nil {
+			if member = c.pick(); member == nil {
+				continue
+			}
+			member.inflight++
+			p.member = member
+		}
+		p.count++
+		p.deadline = now.Add(member.opts.AckWait)
+		msg := channel[seq-1]
+		msg.Redelivered = true
+		msg.RedeliveryCount = p.count
+		member.deliver(&msg)
+	}
+
+	for c.next <= uint64(len(channel)) {
+		member := c.pick()
+		if member == nil {
+			break
+		}
+		member.inflight++
+		c.pending[c.next] = &memoryPending{
+			member:   member,
+			deadline: now.Add(member.opts.AckWait),
+		}
+		msg := channel[c.next-1]
+		member.deliver(&msg)
+		c.next++
+	}
+
+	var wait time.Duration
+	for _, p := range c.pending {
+		if d := p.deadline.Sub(now); d > 0 && (wait == 0 || d < wait) {
+			wait = d
+		}
+	}
+	return wait
+}
+
+//pick choose member with available inflight capacity in round robin order
+func (c *memoryConsumer) pick() *memorySubscription {
+	for i := 0; i < len(c.members); i++ {
+		member := c.members[(c.rr+i)%len(c.members)]
+		if member.inflight < member.opts.MaxInflight {
+			c.rr = (c.rr + i + 1) % len(c.members)
+			return member
+		}
+	}
+	return nil
+}
+
+func (c *memoryConsumer) ack(seq uint64) error {
+	b := c.broker
+	b.mu.Lock()
+	if p, ok := c.pending[seq]; ok {
+		if p.member != nil {
+			p.member.inflight--
+		}
+		delete(c.pending, seq)
+	}
+	notify := c.notify
+	b.mu.Unlock()
+	wake(notify)
+	return nil
+}
+
+func (s *memorySubscription) deliver(msg *Msg) {
+	if s.opts.ManualAck {
+		seq := msg.Sequence
+		msg.ack = func() error { return s.consumer.ack(seq) }
+	}
+	s.queue = append(s.queue, msg)
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (s *memorySubscription) close() {
+	s.closed = true
+	s.queue = nil
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (s *memorySubscription) run() {
+	b := s.consumer.broker
+	for range s.signal {
+		for {
+			b.mu.Lock()
+			if s.closed {
+				b.mu.Unlock()
+				return
+			}
+			if len(s.queue) == 0 {
+				b.mu.Unlock()
+				break
+			}
+			msg := s.queue[0]
+			s.queue = s.queue[1:]
+			b.mu.Unlock()
+
+			s.handler(msg)
+			if !s.opts.ManualAck {
+				s.consumer.ack(msg.Sequence)
+			}
+		}
+	}
+}
+
+//Unsubscribe remove subscription including its durable state
+func (s *memorySubscription) Unsubscribe() error {
+	return s.consumer.broker.remove(s, false)
+}
+
+//Close close subscription keeping its durable state
+func (s *memorySubscription) Close() error {
+	return s.consumer.broker.remove(s, true)
+}
@@ -0,0 +1,195 @@
+package event
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryBrokerStartPositions(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	broker.Publish("account", []byte("a1"))
+	broker.Publish("account", []byte("a2"))
+	time.Sleep(10 * time.Millisecond)
+	since := time.Now()
+	broker.Publish("account", []byte("a3"))
+
+	tests := []struct {
+		name  string
+		start StartPosition
+		first string
+	}{
+		{name: "all", start: StartPosition{Kind: StartAll}, first: "a1"},
+		{name: "last", start: StartPosition{Kind: StartLast}, first: "a3"},
+		{name: "sequence", start: StartPosition{Kind: StartSequence, Sequence: 2}, first: "a2"},
+		{name: "time", start: StartPosition{Kind: StartTime, Time: since}, first: "a3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sub, received := collect(t, broker, "account", SubscribeOptions{Start: test.start})
+			defer sub.Unsubscribe()
+			if msg := receive(t, received); string(msg.Data) != test.first {
+				t.Fatalf("first message is %s, expected %s", msg.Data, test.first)
+			}
+		})
+	}
+
+	sub, received := collect(t, broker, "account", SubscribeOptions{})
+	defer sub.Unsubscribe()
+	expectNone(t, received)
+	broker.Publish("account", []byte("a4"))
+	if msg := receive(t, received); string(msg.Data) != "a4" || msg.Sequence != 4 {
+		t.Fatalf("new subscription received %s at sequence %d", msg.Data, msg.Sequence)
+	}
+}
+
+func TestMemoryBrokerAckRedelivery(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	var once sync.Once
+	received := make(chan *Msg, 10)
+	sub, err := broker.Subscribe("account", func(msg *Msg) {
+		received <- msg
+		first := false
+		once.Do(func() { first = true })
+		if !first {
+			msg.Ack()
+		}
+	}, SubscribeOptions{ManualAck: true, AckWait: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	broker.Publish("account", []byte("a1"))
+	if msg := receive(t, received); msg.Redelivered {
+		t.Fatal("first delivery is marked redelivered")
+	}
+	msg := receive(t, received)
+	if !msg.Redelivered || msg.RedeliveryCount != 1 || string(msg.Data) != "a1" {
+		t.Fatalf("unexpected redelivery %+v", msg)
+	}
+	expectNone(t, received)
+}
+
+func TestMemoryBrokerAutoAck(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	sub, received := collect(t, broker, "account", SubscribeOptions{AckWait: 50 * time.Millisecond})
+	defer sub.Unsubscribe()
+
+	broker.Publish("account", []byte("a1"))
+	receive(t, received)
+	expectNone(t, received)
+}
+
+func TestMemoryBrokerMaxInflight(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	sub, received := collect(t, broker, "account", SubscribeOptions{ManualAck: true, MaxInflight: 1})
+	defer sub.Unsubscribe()
+
+	broker.Publish("account", []byte("a1"))
+	broker.Publish("account", []byte("a2"))
+	msg := receive(t, received)
+	expectNone(t, received)
+	msg.Ack()
+	if msg = receive(t, received); string(msg.Data) != "a2" {
+		t.Fatalf("received %s after ack, expected a2", msg.Data)
+	}
+}
+
+func TestMemoryBrokerQueueGroup(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	opts := SubscribeOptions{QueueGroup: "workers"}
+	first, firsts := collect(t, broker, "account", opts)
+	defer first.Unsubscribe()
+	second, seconds := collect(t, broker, "account", opts)
+	defer second.Unsubscribe()
+
+	for i := 0; i < 10; i++ {
+		broker.Publish("account", []byte{byte('0' + i)})
+	}
+	seen := make(map[string]bool)
+	counts := make(map[chan *Msg]int)
+	for i := 0; i < 10; i++ {
+		var msg *Msg
+		select {
+		case msg = <-firsts:
+			counts[firsts]++
+		case msg = <-seconds:
+			counts[seconds]++
+		case <-time.After(5 * time.Second):
+			t.Fatal("message is not received")
+		}
+		if seen[string(msg.Data)] {
+			t.Fatalf("message %s is delivered to more than one member", msg.Data)
+		}
+		seen[string(msg.Data)] = true
+	}
+	if counts[firsts] != 5 || counts[seconds] != 5 {
+		t.Fatalf("messages are not distributed round robin: %d and %d", counts[firsts], counts[seconds])
+	}
+}
+
+func TestMemoryBrokerQueueGroupRedeliversToRemainingMember(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	opts := SubscribeOptions{QueueGroup: "workers", ManualAck: true, AckWait: 50 * time.Millisecond, MaxInflight: 1}
+	first, firsts := collect(t, broker, "account", opts)
+	broker.Publish("account", []byte("a1"))
+	receive(t, firsts)
+
+	second, seconds := collect(t, broker, "account", opts)
+	defer second.Unsubscribe()
+	first.Unsubscribe()
+	msg := receive(t, seconds)
+	if string(msg.Data) != "a1" || !msg.Redelivered {
+		t.Fatalf("remaining member received %+v", msg)
+	}
+}
+
+func TestMemoryBrokerDurableResume(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	opts := SubscribeOptions{Durable: "archiver", Start: StartPosition{Kind: StartAll}}
+	broker.Publish("account", []byte("a1"))
+	sub, received := collect(t, broker, "account", opts)
+	receive(t, received)
+
+	if _, err := broker.Subscribe("account", func(*Msg) {}, opts); err == nil {
+		t.Fatal("duplicate durable registration is accepted")
+	}
+
+	//closed durable resumes after the last acknowledged message regardless of start position
+	sub.Close()
+	broker.Publish("account", []byte("a2"))
+	sub, received = collect(t, broker, "account", opts)
+	if msg := receive(t, received); string(msg.Data) != "a2" {
+		t.Fatalf("resumed durable received %s, expected a2", msg.Data)
+	}
+	expectNone(t, received)
+
+	//unsubscribed durable starts again from its start position
+	sub.Unsubscribe()
+	sub, received = collect(t, broker, "account", opts)
+	defer sub.Unsubscribe()
+	if msg := receive(t, received); string(msg.Data) != "a1" {
+		t.Fatalf("new durable received %s, expected a1", msg.Data)
+	}
+}
+
+func TestMemoryBrokerClose(t *testing.T) {
+	broker := NewMemoryBroker()
+	_, received := collect(t, broker, "account", SubscribeOptions{})
+	broker.Close()
+	if err := broker.Publish("account", []byte("a1")); err == nil {
+		t.Fatal("closed broker accepts publish")
+	}
+	if _, err := broker.Subscribe("account", func(*Msg) {}, SubscribeOptions{}); err == nil {
+		t.Fatal("closed broker accepts subscription")
+	}
+	expectNone(t, received)
+}
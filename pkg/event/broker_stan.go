@@ -0,0 +1,102 @@
+package event
+
+import (
+	"fmt"
+
+	stan "github.com/nats-io/stan.go"
+	"github.com/nats-io/stan.go/pb"
+)
+
+type stanBroker struct {
+	conn stan.Conn
+}
+
+//NewStanBroker create broker backed by nats streaming connection
+func NewStanBroker(conn stan.Conn) Broker {
+	return &stanBroker{conn: conn}
+}
+
+func (b *stanBroker) Publish(subject string, data []byte) error {
+	return b.conn.Publish(subject, data)
+}
+
+func (b *stanBroker) Subscribe(subject string, handler MsgHandler, opts SubscribeOptions) (Subscription, error) {
+	var subOpts []stan.SubscriptionOption
+	if opts.Durable != "" {
+		subOpts = append(subOpts, stan.DurableName(opts.Durable))
+	}
+	switch opts.Start.Kind {
+	case StartAll:
+		subOpts = append(subOpts, stan.DeliverAllAvailable())
+	case StartLast:
+		subOpts = append(subOpts, stan.StartWithLastReceived())
+	case StartSequence:
+		subOpts = append(subOpts, stan.StartAtSequence(opts.Start.Sequence))
+	case StartTime:
+		subOpts = append(subOpts, stan.StartAtTime(opts.Start.Time))
+	}
+	if opts.ManualAck {
+		subOpts = append(subOpts, stan.SetManualAckMode())
+	}
+	if opts.AckWait > 0 {
+		subOpts = append(subOpts, stan.AckWait(opts.AckWait))
+	}
+	if opts.MaxInflight > 0 {
+		subOpts = append(subOpts, stan.MaxInflight(opts.MaxInflight))
+	}
+
+	cb := func(m *stan.Msg) {
+		msg := &Msg{
+			Subject:         m.Subject,
+			Sequence:        m.Sequence,
+			Data:            m.Data,
+			Timestamp:       m.Timestamp,
+			Redelivered:     m.Redelivered,
+			RedeliveryCount: m.RedeliveryCount,
+			raw:             m,
+		}
+		if opts.ManualAck {
+			msg.ack = m.Ack
+		}
+		handler(msg)
+	}
+
+	if opts.QueueGroup != "" {
+		return b.conn.QueueSubscribe(subject, opts.QueueGroup, cb, subOpts...)
+	}
+	return b.conn.Subscribe(subject, cb, subOpts...)
+}
+
+//stanHandler adapts stan message handler into broker message handler.
+//Message not delivered by stan (see Subscriber.Inject) is converted into stan message without subscription and acknowledged
+//when handler returns, handler acknowledging it itself fails the message since stan message can not be acknowledged without subscription.
+func stanHandler(handler stan.MsgHandler) MsgHandler {
+	return func(msg *Msg) {
+		if m, ok := msg.raw.(*stan.Msg); ok {
+			handler(m)
+			return
+		}
+		if err := handleInjected(handler, msg); err != nil {
+			msg.err = err
+			return
+		}
+		msg.Ack()
+	}
+}
+
+func handleInjected(handler stan.MsgHandler, msg *Msg) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("stan handler failed on injected message of %s: %v", msg.Subject, r)
+		}
+	}()
+	handler(&stan.Msg{MsgProto: pb.MsgProto{
+		Subject:         msg.Subject,
+		Sequence:        msg.Sequence,
+		Data:            msg.Data,
+		Timestamp:       msg.Timestamp,
+		Redelivered:     msg.Redelivered,
+		RedeliveryCount: msg.RedeliveryCount,
+	}})
+	return nil
+}
@@ -0,0 +1,173 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/johnjerrico/gokit-starter-pack/pkg/db"
+)
+
+//Bus in-process event bus delivering envelopes into handlers of the same service without broker.
+//Handlers are subscribed by domain.model.event_type.status pattern (see Router) and run synchronously within Publish
+//unless they are subscribed with BusAsync or BusAfterCommit.
+type Bus struct {
+	logger log.Logger
+
+	mu            sync.RWMutex
+	subscriptions []*busSubscription
+	wg            sync.WaitGroup
+}
+
+//BusOption sets optional parameter of Bus
+type BusOption func(*Bus)
+
+//BusLogger sets logger for errors of handlers which can not be returned by Publish
+func BusLogger(logger log.Logger) BusOption {
+	return func(b *Bus) { b.logger = logger }
+}
+
+//BusSubscribeOption sets optional parameter of a bus subscription
+type BusSubscribeOption func(*busSubscription)
+
+//BusAsync run handler in its own goroutine, Publish does not wait for it and its error is logged
+func BusAsync() BusSubscribeOption {
+	return func(s *busSubscription) { s.async = true }
+}
+
+//BusAfterCommit run handler after transaction of publish context commits (see db.RunInTransactionContext),
+//handler is not run when the transaction rolls back and its error is logged. Publish fails with db.ErrNoAfterCommit
+//when context holds transaction put by db.NewContext only, since its commit can not be awaited.
+func BusAfterCommit() BusSubscribeOption {
+	return func(s *busSubscription) { s.afterCommit = true }
+}
+
+type busSubscription struct {
+	bus         *Bus
+	pattern     []string
+	handler     Handler
+	async       bool
+	afterCommit bool
+}
+
+//Unsubscribe remove handler from bus
+func (s *busSubscription) Unsubscribe() error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	for i, subscription := range s.bus.subscriptions {
+		if subscription == s {
+			s.bus.subscriptions = append(s.bus.subscriptions[:i:i], s.bus.subscriptions[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+//Close remove handler from bus, bus subscription has no durable state
+func (s *busSubscription) Close() error {
+	return s.Unsubscribe()
+}
+
+//NewBus create in-process bus without handlers
+func NewBus(opts ...BusOption) *Bus {
+	b := &Bus{logger: log.NewNopLogger()}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+//Subscribe register handler of envelopes matching pattern
+func (b *Bus) Subscribe(pattern string, handler Handler, opts ...BusSubscribeOption) (Subscription, error) {
+	segments, err := parseRoutePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	s := &busSubscription{bus: b, pattern: segments, handler: handler}
+	for _, opt := range opts {
+		opt(s)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions = append(b.subscriptions, s)
+	return s, nil
+}
+
+//Emit publish commit envelope of json encoded data, request, correlation and trace ids are taken from context
+func (b *Bus) Emit(ctx context.Context, domain, model, eventType, eventSource string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	envelope := &Envelope{
+		Domain:        domain,
+		Model:         model,
+		Status:        StatusCommit,
+		EventType:     eventType,
+		EventSource:   eventSource,
+		SchemaVersion: 1,
+		Data:          payload,
+	}
+	envelope.Inject(ctx)
+	return b.Publish(ctx, envelope)
+}
+
+//Publish deliver envelope into every matching handler in subscription order.
+//Synchronous handlers receive publish context, so they join its transaction, and the first failing one stops delivery
+//and its error is returned. Async and after commit handlers receive context with ids of envelope only.
+func (b *Bus) Publish(ctx context.Context, envelope *Envelope) error {
+	if envelope.RequestID == "" && envelope.CorrelationID == "" && envelope.TraceID == "" {
+		envelope.Inject(ctx)
+	}
+	values := []string{envelope.Domain, envelope.Model, envelope.EventType, envelope.Status}
+	var subscriptions []*busSubscription
+	b.mu.RLock()
+	for _, s := range b.subscriptions {
+		if matchRoute(s.pattern, values) {
+			subscriptions = append(subscriptions, s)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, s := range subscriptions {
+		switch {
+		case s.afterCommit:
+			detached := *envelope
+			if err := db.AfterCommit(ctx, func() { b.deliver(s, &detached) }); err != nil {
+				return err
+			}
+		case s.async:
+			detached := *envelope
+			b.deliver(s, &detached)
+		default:
+			if err := s.handler(ctx, envelope); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//deliver run handler detached from publish context
+func (b *Bus) deliver(s *busSubscription, envelope *Envelope) {
+	run := func() {
+		if err := s.handler(envelope.Extract(context.Background()), envelope); err != nil {
+			b.logger.Log("bus", "Error when handling "+envelope.Domain+"."+envelope.Model+"."+envelope.EventType, "err", err)
+		}
+	}
+	if !s.async {
+		run()
+		return
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		run()
+	}()
+}
+
+//Wait wait until running async handlers return, call it after publishing stops to shutdown gracefully
+func (b *Bus) Wait() {
+	b.wg.Wait()
+}
@@ -0,0 +1,416 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const asyncAPIVersion = "2.6.0"
+
+const (
+	//CatalogPublish entry of envelopes published by the service
+	CatalogPublish = "publish"
+	//CatalogSubscribe entry of envelopes consumed by the service
+	CatalogSubscribe = "subscribe"
+)
+
+//CatalogEntry registration of a publisher Store or a Subscriber, empty domain, model, event type or status means any
+type CatalogEntry struct {
+	Direction     string
+	Subject       string
+	Domain        string
+	Model         string
+	EventType     string
+	Status        string
+	EventSource   string
+	QueueGroup    string
+	Durable       string
+	SchemaVersion int
+	Payload       interface{} //value or pointer of payload type, nil when unknown
+}
+
+//name of message described by entry, ex: account.user.create.commit
+func (e CatalogEntry) name() string {
+	var parts []string
+	for _, part := range []string{e.Domain, e.Model, e.EventType, e.Status} {
+		if part == "" {
+			part = "*"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ".")
+}
+
+//Catalog registry of event contract of a service, every Store of publisher and every Subscriber created with catalog option is recorded.
+//It is rendered as AsyncAPI 2.x document or as human readable table.
+type Catalog struct {
+	title       string
+	version     string
+	description string
+	schemas     *Schemas
+
+	mu      sync.RWMutex
+	entries []CatalogEntry
+}
+
+//CatalogOption sets optional parameter of Catalog
+type CatalogOption func(*Catalog)
+
+//CatalogDescription sets description of the service in AsyncAPI document
+func CatalogDescription(description string) CatalogOption {
+	return func(c *Catalog) { c.description = description }
+}
+
+//CatalogSchemas describe payload with json schema registered in schemas instead of schema derived from payload type
+func CatalogSchemas(schemas *Schemas) CatalogOption {
+	return func(c *Catalog) { c.schemas = schemas }
+}
+
+//NewCatalog create empty catalog of service title at version
+func NewCatalog(title, version string, opts ...CatalogOption) *Catalog {
+	c := &Catalog{title: title, version: version}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+//PublisherCatalog record every Store of publisher into catalog, see StorePayload
+func PublisherCatalog(catalog *Catalog) PublisherOption {
+	return func(p *Publisher) { p.catalog = catalog }
+}
+
+//StorePayload describe request published with status begin and response published with status commit in catalog
+func StorePayload(request, response interface{}) StoreOption {
+	return func(o *storeOptions) {
+		o.request = request
+		o.response = response
+	}
+}
+
+//SubscriberCatalog record subscriber into catalog with envelopes it handles,
+//subject, queue group and durable of entries are filled by subscriber. Without entries any envelope of subject is recorded.
+func SubscriberCatalog(catalog *Catalog, entries ...CatalogEntry) SubscriberOption {
+	return func(s *Subscriber) {
+		s.catalog = catalog
+		s.catalogEntries = entries
+	}
+}
+
+//register record published statuses of Store endpoint
+func (p *Publisher) register(domain, model, eventType, eventSource string, subjects Routes, options storeOptions) {
+	version := 1
+	if p.upcasters != nil {
+		version = p.upcasters.Current(domain, model, eventType)
+	}
+	payloads := map[string]interface{}{
+		StatusBegin:  options.request,
+		StatusCommit: options.response,
+		StatusError:  "",
+	}
+	for _, status := range []string{StatusBegin, StatusCommit, StatusError} {
+		if subjects[status] == "" {
+			continue
+		}
+		p.catalog.Register(CatalogEntry{
+			Direction:     CatalogPublish,
+			Subject:       subjects[status],
+			Domain:        domain,
+			Model:         model,
+			EventType:     eventType,
+			Status:        status,
+			EventSource:   eventSource,
+			SchemaVersion: version,
+			Payload:       payloads[status],
+		})
+	}
+}
+
+//register record subscriber with envelopes it handles
+func (s *Subscriber) register() {
+	entries := s.catalogEntries
+	if len(entries) == 0 {
+		entries = []CatalogEntry{{}}
+	}
+	for _, entry := range entries {
+		entry.Direction = CatalogSubscribe
+		entry.Subject = s.subject
+		entry.QueueGroup = s.queueGroup
+		entry.Durable = s.durable
+		s.catalog.Register(entry)
+	}
+}
+
+//Register record entry, entry equal to a recorded one is ignored
+func (c *Catalog) Register(entry CatalogEntry) {
+	if entry.SchemaVersion == 0 {
+		entry.SchemaVersion = 1
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.entries {
+		if reflect.DeepEqual(e, entry) {
+			return
+		}
+	}
+	c.entries = append(c.entries, entry)
+}
+
+//Entries return recorded entries sorted by subject, direction and message name
+func (c *Catalog) Entries() []CatalogEntry {
+	c.mu.RLock()
+	entries := append([]CatalogEntry(nil), c.entries...)
+	c.mu.RUnlock()
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Subject != entries[j].Subject {
+			return entries[i].Subject < entries[j].Subject
+		}
+		if entries[i].Direction != entries[j].Direction {
+			return entries[i].Direction < entries[j].Direction
+		}
+		return entries[i].name() < entries[j].name()
+	})
+	return entries
+}
+
+//AsyncAPI render catalog as AsyncAPI 2.x json document.
+//AsyncAPI operations are described from the service point of view: envelopes the service publishes are
+//subscribe operations of the channel and envelopes it consumes are publish operations.
+func (c *Catalog) AsyncAPI() ([]byte, error) {
+	info := map[string]interface{}{"title": c.title, "version": c.version}
+	if c.description != "" {
+		info["description"] = c.description
+	}
+	channels := make(map[string]map[string]interface{})
+	messages := make(map[string]map[string][]interface{})
+	groups := make(map[string]map[string]string)
+	for _, entry := range c.Entries() {
+		operation := "subscribe"
+		if entry.Direction == CatalogSubscribe {
+			operation = "publish"
+		}
+		if channels[entry.Subject] == nil {
+			channels[entry.Subject] = make(map[string]interface{})
+			messages[entry.Subject] = make(map[string][]interface{})
+			groups[entry.Subject] = make(map[string]string)
+		}
+		messages[entry.Subject][operation] = append(messages[entry.Subject][operation], c.message(entry))
+		if entry.QueueGroup != "" {
+			groups[entry.Subject][operation] = entry.QueueGroup
+		}
+	}
+	for subject, operations := range messages {
+		for operation, list := range operations {
+			op := map[string]interface{}{"operationId": operationID(operation, subject)}
+			if len(list) == 1 {
+				op["message"] = list[0]
+			} else {
+				op["message"] = map[string]interface{}{"oneOf": list}
+			}
+			if group := groups[subject][operation]; group != "" {
+				op["bindings"] = map[string]interface{}{"nats": map[string]interface{}{"queue": group}}
+			}
+			channels[subject][operation] = op
+		}
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"asyncapi":           asyncAPIVersion,
+		"info":               info,
+		"defaultContentType": "application/json",
+		"channels":           channels,
+	}, "", "  ")
+}
+
+func operationID(operation, subject string) string {
+	return operation + "_" + strings.NewReplacer(".", "_", "*", "any", ">", "all").Replace(subject)
+}
+
+//message describe envelope of entry as AsyncAPI message
+func (c *Catalog) message(entry CatalogEntry) map[string]interface{} {
+	properties := map[string]interface{}{
+		"event_source":   map[string]interface{}{"type": "string"},
+		"request_id":     map[string]interface{}{"type": "string"},
+		"correlation_id": map[string]interface{}{"type": "string"},
+		"trace_id":       map[string]interface{}{"type": "string"},
+		"data":           c.payloadSchema(entry),
+	}
+	for field, value := range map[string]string{
+		"domain":     entry.Domain,
+		"model":      entry.Model,
+		"event_type": entry.EventType,
+		"status":     entry.Status,
+	} {
+		schema := map[string]interface{}{"type": "string"}
+		if value != "" {
+			schema["const"] = value
+		}
+		properties[field] = schema
+	}
+	schemaVersion := map[string]interface{}{"type": "integer"}
+	if entry.Domain != "" && entry.Model != "" && entry.EventType != "" {
+		schemaVersion["const"] = entry.SchemaVersion
+	}
+	properties["schema_version"] = schemaVersion
+
+	message := map[string]interface{}{
+		"name":        entry.name(),
+		"contentType": "application/json",
+		"payload": map[string]interface{}{
+			"type":       "object",
+			"required":   []string{"domain", "model", "status", "event_type", "event_source", "data"},
+			"properties": properties,
+		},
+	}
+	if entry.EventSource != "" {
+		message["x-event-source"] = entry.EventSource
+	}
+	if entry.Durable != "" {
+		message["x-durable"] = entry.Durable
+	}
+	return message
+}
+
+//payloadSchema return registered json schema of entry payload or schema derived from its payload type
+func (c *Catalog) payloadSchema(entry CatalogEntry) interface{} {
+	if c.schemas != nil {
+		if source, ok := c.schemas.Source(entry.Domain, entry.Model, entry.EventType, entry.Status, entry.SchemaVersion); ok {
+			return source
+		}
+	}
+	if entry.Payload == nil {
+		return map[string]interface{}{}
+	}
+	return typeSchema(reflect.TypeOf(entry.Payload), make(map[reflect.Type]bool))
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+//typeSchema derive json schema of values encoded by encoding/json from type, recursive type is described as any value
+func typeSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			return map[string]interface{}{}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		properties := make(map[string]interface{})
+		var required []string
+		structFields(t, seen, properties, &required)
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]interface{}{}
+}
+
+//structFields describe exported fields of struct by their json names, embedded structs without json name are flattened
+func structFields(t reflect.Type, seen map[reflect.Type]bool, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				structFields(embedded, seen, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = typeSchema(field.Type, seen)
+		if !strings.Contains(","+options+",", ",omitempty,") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+//WriteText write catalog as human readable table
+func (c *Catalog) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s %s\n\n", c.title, c.version)
+	fmt.Fprintln(tw, "DIRECTION\tSUBJECT\tEVENT\tVERSION\tPAYLOAD\tSERVICE")
+	for _, entry := range c.Entries() {
+		payload := "-"
+		if entry.Payload != nil {
+			payload = reflect.TypeOf(entry.Payload).String()
+		}
+		service := entry.EventSource
+		if entry.Direction == CatalogSubscribe {
+			service = entry.QueueGroup
+			if entry.Durable != "" {
+				service = strings.TrimPrefix(service+" durable "+entry.Durable, " ")
+			}
+		}
+		if service == "" {
+			service = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", entry.Direction, entry.Subject, entry.name(), entry.SchemaVersion, payload, service)
+	}
+	return tw.Flush()
+}
+
+//ServeHTTP serve AsyncAPI document, or the human readable table when query has format=text, ex: mux.Handle("/debug/events", catalog)
+func (c *Catalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		c.WriteText(w)
+		return
+	}
+	document, err := c.AsyncAPI()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(document)
+}
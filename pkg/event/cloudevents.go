@@ -0,0 +1,166 @@
+package event
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+//CloudEventsSpecVersion version of CloudEvents specification of CloudEvent
+const CloudEventsSpecVersion = "1.0"
+
+//CloudEvent envelope in CloudEvents structured json mode.
+//Type is domain.model.event_type.status, source is event source and subject is model or model/aggregate id,
+//envelope fields are kept in extension attributes so CloudEvent converts back into the same envelope.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+
+	Domain           string `json:"domain,omitempty"`
+	Model            string `json:"model,omitempty"`
+	EventType        string `json:"eventtype,omitempty"`
+	Status           string `json:"status,omitempty"`
+	SchemaVersion    int    `json:"schemaversion,omitempty"`
+	RequestID        string `json:"requestid,omitempty"`
+	CorrelationID    string `json:"correlationid,omitempty"`
+	TraceID          string `json:"traceid,omitempty"`
+	AggregateID      string `json:"aggregateid,omitempty"`
+	AggregateVersion int    `json:"aggregateversion,omitempty"`
+	ContentEncoding  string `json:"contentencoding,omitempty"`
+	SequenceKey      string `json:"sequencekey,omitempty"`
+	Sequence         uint64 `json:"sequence,omitempty,string"`
+}
+
+//PublisherCloudEvents publish envelopes in CloudEvents structured json mode instead of envelope json
+func PublisherCloudEvents() PublisherOption {
+	return func(p *Publisher) { p.cloudEvents = true }
+}
+
+//NewCloudEvent convert envelope into CloudEvent with new id and current time,
+//json payload is embedded as data and any other payload as data_base64
+func NewCloudEvent(envelope *Envelope) (*CloudEvent, error) {
+	source := envelope.EventSource
+	if source == "" {
+		source = "/" + envelope.Domain
+	}
+	subject := envelope.Model
+	if envelope.AggregateID != "" {
+		subject += "/" + envelope.AggregateID
+	}
+	event := &CloudEvent{
+		SpecVersion:      CloudEventsSpecVersion,
+		ID:               uuid.New().String(),
+		Source:           source,
+		Type:             strings.Join([]string{envelope.Domain, envelope.Model, envelope.EventType, envelope.Status}, "."),
+		Subject:          subject,
+		Time:             time.Now().UTC().Format(time.RFC3339Nano),
+		DataContentType:  envelope.ContentType,
+		Domain:           envelope.Domain,
+		Model:            envelope.Model,
+		EventType:        envelope.EventType,
+		Status:           envelope.Status,
+		SchemaVersion:    envelope.SchemaVersion,
+		RequestID:        envelope.RequestID,
+		CorrelationID:    envelope.CorrelationID,
+		TraceID:          envelope.TraceID,
+		AggregateID:      envelope.AggregateID,
+		AggregateVersion: envelope.AggregateVersion,
+		ContentEncoding:  envelope.ContentEncoding,
+		SequenceKey:      envelope.SequenceKey,
+		Sequence:         envelope.Sequence,
+	}
+	if event.DataContentType == "" {
+		event.DataContentType = ContentTypeJSON
+	}
+	if !envelope.embedsBinary() {
+		event.Data = envelope.Data
+		return event, nil
+	}
+	payload, err := envelope.Payload()
+	if err != nil {
+		return nil, err
+	}
+	event.DataBase64 = base64.StdEncoding.EncodeToString(payload)
+	return event, nil
+}
+
+//Envelope convert CloudEvent into envelope. Domain, model and status are taken from envelope extensions only,
+//CloudEvent published by other stacks has none of them, so its whole type becomes event type with status commit.
+func (c *CloudEvent) Envelope() (*Envelope, error) {
+	envelope := &Envelope{
+		Domain:           c.Domain,
+		Model:            c.Model,
+		Status:           c.Status,
+		EventType:        c.EventType,
+		EventSource:      c.Source,
+		SchemaVersion:    c.SchemaVersion,
+		RequestID:        c.RequestID,
+		CorrelationID:    c.CorrelationID,
+		TraceID:          c.TraceID,
+		AggregateID:      c.AggregateID,
+		AggregateVersion: c.AggregateVersion,
+		SequenceKey:      c.SequenceKey,
+		Sequence:         c.Sequence,
+	}
+	if envelope.EventType == "" {
+		envelope.EventType = c.Type
+	}
+	if envelope.Status == "" {
+		envelope.Status = StatusCommit
+	}
+
+	payload := []byte(c.Data)
+	if c.DataBase64 != "" {
+		var err error
+		if payload, err = base64.StdEncoding.DecodeString(c.DataBase64); err != nil {
+			return nil, err
+		}
+	}
+	if len(payload) == 0 {
+		payload = []byte("null")
+	}
+	contentType := c.DataContentType
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = strings.TrimSpace(contentType[:i])
+	}
+	if err := envelope.SetPayload(payload, contentType, c.ContentEncoding); err != nil {
+		return nil, err
+	}
+	return envelope, nil
+}
+
+//UnmarshalEnvelope decode message data published as envelope json or as CloudEvent in structured json mode
+func UnmarshalEnvelope(data []byte) (*Envelope, error) {
+	var probe struct {
+		SpecVersion string `json:"specversion"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+	if probe.SpecVersion == "" {
+		var envelope Envelope
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			return nil, err
+		}
+		return &envelope, nil
+	}
+	if !strings.HasPrefix(probe.SpecVersion, "1.") {
+		return nil, fmt.Errorf("unsupported cloudevents specversion %s", probe.SpecVersion)
+	}
+	var event CloudEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	return event.Envelope()
+}
@@ -0,0 +1,117 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	//ContentTypeJSON content type of json payload
+	ContentTypeJSON = "application/json"
+	//ContentTypeProtobuf content type of protobuf payload
+	ContentTypeProtobuf = "application/protobuf"
+	//ContentTypeMsgpack content type of msgpack payload
+	ContentTypeMsgpack = "application/msgpack"
+)
+
+//Codec encode and decode event payload
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		ContentTypeJSON:     JSONCodec{},
+		ContentTypeProtobuf: ProtobufCodec{},
+		ContentTypeMsgpack:  MsgpackCodec{},
+	}
+)
+
+//RegisterCodec register codec used for decoding payload of its content type
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codec.ContentType()] = codec
+}
+
+//CodecFor return registered codec of content type, empty content type is json
+func CodecFor(contentType string) (Codec, error) {
+	if contentType == "" {
+		contentType = ContentTypeJSON
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	if codec, ok := codecs[contentType]; ok {
+		return codec, nil
+	}
+	return nil, rError.New(fmt.Errorf("no codec registered for content type %s", contentType), rError.Enum.UNSUPPORTEDMEDIATYPE, "unsupported_content_type")
+}
+
+//JSONCodec encode payload as json
+type JSONCodec struct{}
+
+//ContentType ...
+func (JSONCodec) ContentType() string { return ContentTypeJSON }
+
+//Marshal ...
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+//Unmarshal ...
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+//ProtobufCodec encode payload as protobuf, payload must implement proto.Message
+type ProtobufCodec struct{}
+
+//ContentType ...
+func (ProtobufCodec) ContentType() string { return ContentTypeProtobuf }
+
+//Marshal ...
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T does not implement proto.Message", v)
+	}
+	return proto.Marshal(msg)
+}
+
+//Unmarshal ...
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T does not implement proto.Message", v)
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+//MsgpackCodec encode payload as msgpack, struct fields are named by their json tag
+type MsgpackCodec struct{}
+
+//ContentType ...
+func (MsgpackCodec) ContentType() string { return ContentTypeMsgpack }
+
+//Marshal ...
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//Unmarshal ...
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
@@ -0,0 +1,81 @@
+package event
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+	"github.com/klauspost/compress/snappy"
+)
+
+const (
+	//EncodingGzip content encoding of gzip compressed payload
+	EncodingGzip = "gzip"
+	//EncodingSnappy content encoding of snappy compressed payload
+	EncodingSnappy = "snappy"
+)
+
+//Compressor compress and decompress event payload
+type Compressor interface {
+	Encoding() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+//CompressorFor return compressor of content encoding
+func CompressorFor(encoding string) (Compressor, error) {
+	switch encoding {
+	case EncodingGzip:
+		return GzipCompressor{}, nil
+	case EncodingSnappy:
+		return SnappyCompressor{}, nil
+	}
+	return nil, rError.New(fmt.Errorf("unsupported content encoding %s", encoding), rError.Enum.UNSUPPORTEDMEDIATYPE, "unsupported_content_encoding")
+}
+
+//GzipCompressor compress payload with gzip
+type GzipCompressor struct{}
+
+//Encoding ...
+func (GzipCompressor) Encoding() string { return EncodingGzip }
+
+//Compress ...
+func (GzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//Decompress ...
+func (GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+//SnappyCompressor compress payload with snappy
+type SnappyCompressor struct{}
+
+//Encoding ...
+func (SnappyCompressor) Encoding() string { return EncodingSnappy }
+
+//Compress ...
+func (SnappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+//Decompress ...
+func (SnappyCompressor) Decompress(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
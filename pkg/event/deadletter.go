@@ -0,0 +1,68 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+//DeadLetter message which can never be handled, published as json into dead-letter subject.
+//Message data which is not json is kept as base64 in Data instead of Envelope.
+type DeadLetter struct {
+	Record
+	Data   []byte `json:"data,omitempty"`
+	Reason string `json:"reason"`
+}
+
+//NewDeadLetter create dead letter of broker message rejected for reason
+func NewDeadLetter(msg *Msg, reason error) DeadLetter {
+	letter := DeadLetter{Record: NewRecord(msg), Reason: reason.Error()}
+	if !json.Valid(msg.Data) {
+		letter.Envelope = nil
+		letter.Data = msg.Data
+	}
+	return letter
+}
+
+//HandlerValidation validate decrypted envelope against its schema before it is handled
+func HandlerValidation(schemas *Schemas) HandlerOption {
+	return func(h *envelopeHandler) { h.schemas = schemas }
+}
+
+//HandlerDeadLetter publish undecodable envelope and envelope failing its schema into dead-letter subject and acknowledge it,
+//without dead-letter subject such message is not acknowledged
+func HandlerDeadLetter(broker Broker, subject string) HandlerOption {
+	return func(h *envelopeHandler) {
+		h.deadLetterBroker = broker
+		h.deadLetterSubject = subject
+	}
+}
+
+//invalidMessageError message that fails on every delivery, so it is dead-lettered instead of redelivered
+type invalidMessageError struct {
+	err error
+}
+
+func (e *invalidMessageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidMessageError) Unwrap() error {
+	return e.err
+}
+
+//deadLetter publish invalid message into dead-letter subject, returns true when message is dead-lettered
+func (h *envelopeHandler) deadLetter(msg *Msg, reason error) bool {
+	if _, ok := reason.(*invalidMessageError); !ok || h.deadLetterBroker == nil {
+		return false
+	}
+	data, err := json.Marshal(NewDeadLetter(msg, reason))
+	if err == nil {
+		err = h.deadLetterBroker.Publish(h.deadLetterSubject, data)
+	}
+	if err != nil {
+		h.logger.Log("nats", fmt.Sprintf("Error when dead-lettering sequence %d of channel %s", msg.Sequence, msg.Subject), "err", err)
+		return false
+	}
+	h.logger.Log("nats", fmt.Sprintf("Dead-lettered sequence %d of channel %s into %s", msg.Sequence, msg.Subject, h.deadLetterSubject), "reason", reason)
+	return true
+}
@@ -0,0 +1,269 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//EncryptedPrefix marks payload value encrypted by FieldEncryptor, followed by transit key name and ciphertext
+const EncryptedPrefix = "encrypted:"
+
+//Transit encrypt and decrypt value with vault transit key, implemented by vault.Transit
+type Transit interface {
+	Encrypt(ctx context.Context, transitkey string, plaintext []byte) (string, error)
+	Decrypt(ctx context.Context, transitkey, ciphertext string) ([]byte, error)
+}
+
+//FieldEncryptor encrypt selected payload fields with vault transit key and decrypt the same fields on consumer side
+type FieldEncryptor struct {
+	transit    Transit
+	transitkey string
+	paths      [][]string
+	tagged     [][]string
+	accepted   []string
+}
+
+//NewFieldEncryptor create encryptor of fields selected by dot separated json paths (`*` matches any array element or object key).
+//Fields of struct payload tagged with `event:"encrypt"` are encrypted as well.
+func NewFieldEncryptor(transit Transit, transitkey string, paths ...string) *FieldEncryptor {
+	e := &FieldEncryptor{
+		transit:    transit,
+		transitkey: transitkey,
+		accepted:   []string{transitkey},
+	}
+	for _, path := range paths {
+		e.paths = append(e.paths, strings.Split(path, "."))
+	}
+	return e
+}
+
+//Payload decrypt fields of payload type tagged with `event:"encrypt"`, sample is a value or pointer of payload type
+func (e *FieldEncryptor) Payload(sample interface{}) *FieldEncryptor {
+	e.tagged = append(e.tagged, taggedPaths(reflect.TypeOf(sample), nil, nil)...)
+	return e
+}
+
+//Accept accept values encrypted with other transit keys when decrypting, ex: key used before migration
+func (e *FieldEncryptor) Accept(transitkeys ...string) *FieldEncryptor {
+	e.accepted = append(e.accepted, transitkeys...)
+	return e
+}
+
+//Encrypt return json representation of data with selected fields replaced by encrypted value, transit is called with ctx
+func (e *FieldEncryptor) Encrypt(ctx context.Context, data interface{}) (interface{}, error) {
+	paths := append(taggedPaths(reflect.TypeOf(data), nil, nil), e.paths...)
+	if len(paths) == 0 {
+		return data, nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := decodeTree(raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		if tree, err = transformPath(tree, path, func(v interface{}) (interface{}, error) { return e.encryptValue(ctx, v) }); err != nil {
+			return nil, err
+		}
+	}
+	return tree, nil
+}
+
+func (e *FieldEncryptor) encryptValue(ctx context.Context, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := e.transit.Encrypt(ctx, e.transitkey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return EncryptedPrefix + e.transitkey + ":" + ciphertext, nil
+}
+
+//Decrypt decrypt envelope payload fields selected by paths and tagged payload types in place.
+//Encrypted values elsewhere in payload are left as is, value encrypted with not accepted transit key rejects the envelope.
+//Transit is called with ctx.
+func (e *FieldEncryptor) Decrypt(ctx context.Context, envelope *Envelope) error {
+	paths := append(e.tagged[:len(e.tagged):len(e.tagged)], e.paths...)
+	if len(paths) == 0 {
+		return nil
+	}
+	if err := envelope.Decompress(); err != nil {
+		return err
+	}
+	payload, err := envelope.Payload()
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(payload, []byte(EncryptedPrefix)) {
+		return nil
+	}
+	codec, err := CodecFor(envelope.ContentType)
+	if err != nil {
+		return err
+	}
+
+	var tree interface{}
+	if _, ok := codec.(JSONCodec); ok {
+		tree, err = decodeTree(payload)
+	} else {
+		err = codec.Unmarshal(payload, &tree)
+	}
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if tree, err = transformPath(tree, path, func(v interface{}) (interface{}, error) { return e.decryptValue(ctx, v) }); err != nil {
+			return err
+		}
+	}
+	if payload, err = codec.Marshal(tree); err != nil {
+		return err
+	}
+	return envelope.SetPayload(payload, envelope.ContentType, "")
+}
+
+func (e *FieldEncryptor) decryptValue(ctx context.Context, v interface{}) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok || !strings.HasPrefix(s, EncryptedPrefix) {
+		return v, nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(s, EncryptedPrefix), ":", 2)
+	if len(parts) != 2 {
+		return nil, &invalidMessageError{fmt.Errorf("malformed encrypted value")}
+	}
+	if !e.accepts(parts[0]) {
+		return nil, &invalidMessageError{fmt.Errorf("value encrypted with transit key %s is not accepted", parts[0])}
+	}
+	plaintext, err := e.transit.Decrypt(ctx, parts[0], parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return decodeTree(plaintext)
+}
+
+func (e *FieldEncryptor) accepts(transitkey string) bool {
+	for _, accepted := range e.accepted {
+		if accepted == transitkey {
+			return true
+		}
+	}
+	return false
+}
+
+//decodeTree decode json into generic tree keeping integers as int64 so they survive any codec
+func decodeTree(data []byte) (interface{}, error) {
+	var tree interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return transformPath(tree, []string{"**"}, func(v interface{}) (interface{}, error) {
+		n, ok := v.(json.Number)
+		if !ok {
+			return v, nil
+		}
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+		return n.Float64()
+	})
+}
+
+//transformPath apply f to nodes matched by path, `*` matches any child and `**` matches every leaf
+func transformPath(node interface{}, path []string, f func(interface{}) (interface{}, error)) (interface{}, error) {
+	var err error
+	if len(path) == 0 {
+		return f(node)
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			if path[0] == "**" {
+				if n[k], err = transformPath(v, path, f); err != nil {
+					return nil, err
+				}
+			} else if path[0] == "*" || path[0] == k {
+				if n[k], err = transformPath(v, path[1:], f); err != nil {
+					return nil, err
+				}
+			}
+		}
+	case []interface{}:
+		for i, v := range n {
+			if path[0] == "**" {
+				if n[i], err = transformPath(v, path, f); err != nil {
+					return nil, err
+				}
+			} else if path[0] == "*" || path[0] == strconv.Itoa(i) {
+				if n[i], err = transformPath(v, path[1:], f); err != nil {
+					return nil, err
+				}
+			}
+		}
+	default:
+		if path[0] == "**" {
+			return f(node)
+		}
+	}
+	return node, nil
+}
+
+//taggedPaths collect json paths of struct fields tagged with `event:"encrypt"`
+func taggedPaths(t reflect.Type, prefix []string, visiting []reflect.Type) [][]string {
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return taggedPaths(t.Elem(), append(prefix[:len(prefix):len(prefix)], "*"), visiting)
+	case reflect.Struct:
+	default:
+		return nil
+	}
+	for _, v := range visiting {
+		if v == t {
+			return nil
+		}
+	}
+	visiting = append(visiting, t)
+
+	var paths [][]string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name := field.Name
+		if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		} else if field.Anonymous {
+			paths = append(paths, taggedPaths(field.Type, prefix, visiting)...)
+			continue
+		}
+		path := append(prefix[:len(prefix):len(prefix)], name)
+		if field.Tag.Get("event") == "encrypt" {
+			paths = append(paths, path)
+			continue
+		}
+		paths = append(paths, taggedPaths(field.Type, path, visiting)...)
+	}
+	return paths
+}
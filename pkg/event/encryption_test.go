@@ -0,0 +1,178 @@
+package event
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+//fakeTransit encrypt value by encoding transit key and plaintext, it records keys used to decrypt
+type fakeTransit struct {
+	mu        sync.Mutex
+	decrypted []string
+}
+
+func (t *fakeTransit) Encrypt(ctx context.Context, transitkey string, plaintext []byte) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return "vault:v1:" + base64.StdEncoding.EncodeToString([]byte(transitkey+"|"+string(plaintext))), nil
+}
+
+func (t *fakeTransit) Decrypt(ctx context.Context, transitkey, ciphertext string) ([]byte, error) {
+	t.mu.Lock()
+	t.decrypted = append(t.decrypted, transitkey)
+	t.mu.Unlock()
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, "vault:v1:"))
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[0] != transitkey {
+		return nil, errors.New("invalid ciphertext")
+	}
+	return []byte(parts[1]), nil
+}
+
+type secretUser struct {
+	Name       string `json:"name"`
+	NationalID string `json:"national_id" event:"encrypt"`
+	Note       string `json:"note"`
+}
+
+func TestPublisherEncryptionEncryptsBeginAndCommit(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	encryptor := NewFieldEncryptor(&fakeTransit{}, "users", "accounts.*.number")
+	publisher := NewBrokerPublisher(broker, log.NewNopLogger(), PublisherEncryption(encryptor))
+	endpoint := publisher.Store("bank", "user", "create", "user", "test", func(ctx context.Context, request interface{}) (interface{}, error) {
+		return request, nil
+	}, func(data interface{}) interface{} { return data })
+
+	request := map[string]interface{}{"accounts": []interface{}{map[string]interface{}{"number": "1234-5678"}}}
+	if _, err := endpoint(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := endpoint(context.Background(), secretUser{Name: "alice", NationalID: "3201"}); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := broker.Messages("user")
+	if len(messages) != 4 {
+		t.Fatalf("published %d envelopes, expected 4", len(messages))
+	}
+	for _, msg := range messages {
+		if strings.Contains(string(msg.Data), "1234-5678") || strings.Contains(string(msg.Data), "3201") {
+			t.Fatalf("envelope is published with plaintext field %s", msg.Data)
+		}
+		if !strings.Contains(string(msg.Data), EncryptedPrefix+"users:") {
+			t.Fatalf("envelope is published without encrypted field %s", msg.Data)
+		}
+	}
+}
+
+func TestPublisherEncryptionUsesRequestContext(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	publisher := NewBrokerPublisher(broker, log.NewNopLogger(), PublisherEncryption(NewFieldEncryptor(&fakeTransit{}, "users")))
+	endpoint := publisher.Store("bank", "user", "create", "user", "test", func(ctx context.Context, request interface{}) (interface{}, error) {
+		return request, nil
+	}, func(data interface{}) interface{} { return data })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := endpoint(ctx, secretUser{Name: "alice", NationalID: "3201"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("encryption with cancelled request context returned %v", err)
+	}
+	if len(broker.Messages("user")) != 0 {
+		t.Fatal("envelope failing encryption is published")
+	}
+}
+
+func TestHandlerDecryption(t *testing.T) {
+	transit := &fakeTransit{}
+	encrypted := func(transitkey, value string) string {
+		ciphertext, _ := transit.Encrypt(context.Background(), transitkey, []byte(`"`+value+`"`))
+		return EncryptedPrefix + transitkey + ":" + ciphertext
+	}
+	tests := []struct {
+		name      string
+		user      secretUser
+		expected  secretUser
+		rejected  bool
+		decrypted []string
+	}{
+		{
+			name:      "tagged field",
+			user:      secretUser{Name: "alice", NationalID: encrypted("users", "3201")},
+			expected:  secretUser{Name: "alice", NationalID: "3201"},
+			decrypted: []string{"users"},
+		},
+		{
+			name:      "accepted key",
+			user:      secretUser{Name: "alice", NationalID: encrypted("legacy", "3201")},
+			expected:  secretUser{Name: "alice", NationalID: "3201"},
+			decrypted: []string{"legacy"},
+		},
+		{
+			name:     "other key",
+			user:     secretUser{Name: "alice", NationalID: encrypted("payments", "3201")},
+			rejected: true,
+		},
+		{
+			name:     "malformed value",
+			user:     secretUser{Name: "alice", NationalID: EncryptedPrefix + "users"},
+			rejected: true,
+		},
+		{
+			name:     "not selected field",
+			user:     secretUser{Name: "alice", Note: encrypted("payments", "secret")},
+			expected: secretUser{Name: "alice", Note: encrypted("payments", "secret")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transit.decrypted = nil
+			var handled secretUser
+			decryptor := NewFieldEncryptor(transit, "users").Accept("legacy").Payload(&secretUser{})
+			handler := Handle(func(ctx context.Context, envelope *Envelope) error {
+				return envelope.Decode(&handled)
+			}, HandlerDecryption(decryptor))
+
+			payload := fmt.Sprintf(`{"name":%q,"national_id":%q,"note":%q}`, test.user.Name, test.user.NationalID, test.user.Note)
+			data := fmt.Sprintf(`{"domain":"bank","model":"user","status":"commit","event_type":"create","data":%s}`, payload)
+			acked := false
+			msg := NewMsg("user", 1, []byte(data), func() error {
+				acked = true
+				return nil
+			})
+			handler(msg)
+
+			var invalid *invalidMessageError
+			if test.rejected {
+				if acked || !errors.As(msg.Err(), &invalid) {
+					t.Fatalf("envelope is not rejected, acked %v, err %v", acked, msg.Err())
+				}
+				if len(transit.decrypted) != 0 {
+					t.Fatalf("rejected value is decrypted with %v", transit.decrypted)
+				}
+				return
+			}
+			if !acked || msg.Err() != nil {
+				t.Fatalf("envelope is not handled, acked %v, err %v", acked, msg.Err())
+			}
+			if handled != test.expected {
+				t.Fatalf("handled %+v, expected %+v", handled, test.expected)
+			}
+			if fmt.Sprint(transit.decrypted) != fmt.Sprint(test.decrypted) {
+				t.Fatalf("decrypted with %v, expected %v", transit.decrypted, test.decrypted)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/johnjerrico/gokit-starter-pack/pkg/trace"
+)
+
+const (
+	//StatusBegin published before endpoint invoked
+	StatusBegin = "begin"
+	//StatusCommit published after endpoint succeed
+	StatusCommit = "commit"
+	//StatusError published after endpoint failed
+	StatusError = "error"
+)
+
+//Envelope wraps event data published into nats
+type Envelope struct {
+	Domain           string          `json:"domain"`
+	Model            string          `json:"model"`
+	Status           string          `json:"status"`
+	EventType        string          `json:"event_type"`
+	EventSource      string          `json:"event_source"`
+	SchemaVersion    int             `json:"schema_version,omitempty"`
+	RequestID        string          `json:"request_id,omitempty"`
+	CorrelationID    string          `json:"correlation_id,omitempty"`
+	TraceID          string          `json:"trace_id,omitempty"`
+	ContentType      string          `json:"content_type,omitempty"`
+	ContentEncoding  string          `json:"content_encoding,omitempty"`
+	AggregateID      string          `json:"aggregate_id,omitempty"`
+	AggregateVersion int             `json:"aggregate_version,omitempty"`
+	SequenceKey      string          `json:"sequence_key,omitempty"`
+	Sequence         uint64          `json:"sequence,omitempty"`
+	Data             json.RawMessage `json:"data"`
+}
+
+//Inject copy request, correlation and trace ids from context into envelope
+func (e *Envelope) Inject(ctx context.Context) {
+	if ids, ok := trace.FromContext(ctx); ok {
+		e.RequestID = ids.RequestID
+		e.CorrelationID = ids.CorrelationID
+		e.TraceID = ids.TraceID
+	}
+}
+
+//Extract restore request, correlation and trace ids of envelope into context
+func (e *Envelope) Extract(ctx context.Context) context.Context {
+	ids := trace.IDs{
+		RequestID:     e.RequestID,
+		CorrelationID: e.CorrelationID,
+		TraceID:       e.TraceID,
+	}
+	if ids.IsEmpty() {
+		return ctx
+	}
+	return trace.NewContext(ctx, ids)
+}
+
+//Version return schema version of envelope, envelope published before versioning is treated as version 1
+func (e *Envelope) Version() int {
+	if e.SchemaVersion < 1 {
+		return 1
+	}
+	return e.SchemaVersion
+}
+
+//Payload return raw payload bytes of envelope data.
+//Uncompressed json payload is embedded as is, other payload is embedded as base64 string.
+func (e *Envelope) Payload() ([]byte, error) {
+	if !e.embedsBinary() {
+		return e.Data, nil
+	}
+	var payload []byte
+	if err := json.Unmarshal(e.Data, &payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+//SetPayload sets envelope data from raw payload bytes of content type and content encoding
+func (e *Envelope) SetPayload(payload []byte, contentType, contentEncoding string) error {
+	if contentType == ContentTypeJSON {
+		contentType = ""
+	}
+	e.ContentType = contentType
+	e.ContentEncoding = contentEncoding
+	if !e.embedsBinary() {
+		e.Data = payload
+		return nil
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	e.Data = data
+	return nil
+}
+
+//Decompress decompress envelope data in place
+func (e *Envelope) Decompress() error {
+	if e.ContentEncoding == "" {
+		return nil
+	}
+	payload, err := e.decompressed()
+	if err != nil {
+		return err
+	}
+	return e.SetPayload(payload, e.ContentType, "")
+}
+
+//Decode unmarshal envelope data into v using codec of its content type, envelope is left unchanged
+func (e *Envelope) Decode(v interface{}) error {
+	codec, err := CodecFor(e.ContentType)
+	if err != nil {
+		return err
+	}
+	payload, err := e.decompressed()
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(payload, v)
+}
+
+//decompressed return uncompressed payload bytes without changing envelope
+func (e *Envelope) decompressed() ([]byte, error) {
+	payload, err := e.Payload()
+	if err != nil || e.ContentEncoding == "" {
+		return payload, err
+	}
+	compressor, err := CompressorFor(e.ContentEncoding)
+	if err != nil {
+		return nil, err
+	}
+	return compressor.Decompress(payload)
+}
+
+func (e *Envelope) embedsBinary() bool {
+	return e.ContentEncoding != "" || (e.ContentType != "" && e.ContentType != ContentTypeJSON)
+}
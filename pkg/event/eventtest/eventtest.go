@@ -0,0 +1,214 @@
+//Package eventtest provides utilities for testing endpoints wrapped by event.Publisher and handlers of event.Subscriber
+//without nats server.
+package eventtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/johnjerrico/gokit-starter-pack/pkg/event"
+)
+
+//Published envelope captured by Recorder
+type Published struct {
+	Subject  string
+	Envelope *event.Envelope
+	Data     []byte
+}
+
+//Recorder broker capturing published envelopes, messages are also delivered to subscribers of the embedded memory broker.
+//Create publisher under test with event.NewBrokerPublisher(recorder, logger).
+type Recorder struct {
+	*event.MemoryBroker
+
+	mu        sync.Mutex
+	published []Published
+	err       error
+}
+
+//NewRecorder create recording broker
+func NewRecorder() *Recorder {
+	return &Recorder{MemoryBroker: event.NewMemoryBroker()}
+}
+
+//Publish capture envelope published into subject
+func (r *Recorder) Publish(subject string, data []byte) error {
+	r.mu.Lock()
+	if r.err != nil {
+		err := r.err
+		r.mu.Unlock()
+		return err
+	}
+	published := Published{Subject: subject, Data: data}
+	if envelope, err := event.UnmarshalEnvelope(data); err == nil {
+		published.Envelope = envelope
+	}
+	r.published = append(r.published, published)
+	r.mu.Unlock()
+	return r.MemoryBroker.Publish(subject, data)
+}
+
+//FailWith make next publishes fail with err, nil restores publishing
+func (r *Recorder) FailWith(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+//Published return envelopes published into subject in publish order, empty subject returns every envelope
+func (r *Recorder) Published(subject string) []Published {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var published []Published
+	for _, p := range r.published {
+		if subject == "" || p.Subject == subject {
+			published = append(published, p)
+		}
+	}
+	return published
+}
+
+//Reset forget captured envelopes
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.published = nil
+}
+
+//ExpectPublished fails test when no envelope with status matching matcher was published into subject, returns the first match
+func (r *Recorder) ExpectPublished(t testing.TB, subject, status string, matcher Matcher) *event.Envelope {
+	t.Helper()
+	published := r.Published(subject)
+	for _, p := range published {
+		if p.Envelope == nil || p.Envelope.Status != status {
+			continue
+		}
+		if matcher == nil || matcher(p.Envelope) {
+			return p.Envelope
+		}
+	}
+	t.Errorf("expected %s envelope published into %s, got %s", status, subject, describe(published))
+	return nil
+}
+
+//ExpectNotPublished fails test when an envelope with status was published into subject
+func (r *Recorder) ExpectNotPublished(t testing.TB, subject, status string) {
+	t.Helper()
+	for _, p := range r.Published(subject) {
+		if p.Envelope != nil && p.Envelope.Status == status {
+			t.Errorf("expected no %s envelope published into %s, got %s", status, subject, p.Data)
+			return
+		}
+	}
+}
+
+func describe(published []Published) string {
+	if len(published) == 0 {
+		return "nothing"
+	}
+	var lines []string
+	for _, p := range published {
+		lines = append(lines, fmt.Sprintf("\n\t%s: %s", p.Subject, p.Data))
+	}
+	return strings.Join(lines, "")
+}
+
+//Matcher match captured envelope
+type Matcher func(envelope *event.Envelope) bool
+
+//Any match every envelope
+func Any() Matcher {
+	return func(*event.Envelope) bool { return true }
+}
+
+//EventType match envelope of event type
+func EventType(eventType string) Matcher {
+	return func(envelope *event.Envelope) bool { return envelope.EventType == eventType }
+}
+
+//Payload match envelope whose payload decodes into value equal to expected, expected may be a value or pointer
+func Payload(expected interface{}) Matcher {
+	return func(envelope *event.Envelope) bool {
+		t := reflect.TypeOf(expected)
+		if t == nil {
+			return string(envelope.Data) == "null"
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		actual := reflect.New(t)
+		if err := envelope.Decode(actual.Interface()); err != nil {
+			return false
+		}
+		want := reflect.ValueOf(expected)
+		for want.Kind() == reflect.Ptr {
+			want = want.Elem()
+		}
+		return reflect.DeepEqual(actual.Elem().Interface(), want.Interface())
+	}
+}
+
+//All match envelope matching every matcher
+func All(matchers ...Matcher) Matcher {
+	return func(envelope *event.Envelope) bool {
+		for _, matcher := range matchers {
+			if !matcher(envelope) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+//Delivery result of message delivered by Inject or Deliver
+type Delivery struct {
+	Acked bool  //handler acknowledged message, handlers built with event.Handle acknowledge successful messages
+	Err   error //error reported by handler built with event.Handle
+}
+
+var sequence uint64
+
+//NewEnvelope create envelope of status with json payload, panics when data can not be encoded
+func NewEnvelope(domain, model, eventType, status string, data interface{}) *event.Envelope {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	return &event.Envelope{
+		Domain:        domain,
+		Model:         model,
+		Status:        status,
+		EventType:     eventType,
+		EventSource:   "eventtest",
+		SchemaVersion: 1,
+		Data:          payload,
+	}
+}
+
+//Inject deliver envelope into subscriber handler synchronously as message of subject.
+//Handler of subscriber created by event.NewSubscriber receives *stan.Msg without subscription, delivery is acknowledged when it returns
+//and fails when handler panics, ex: by calling Ack of the stan message.
+func Inject(subscriber *event.Subscriber, subject string, envelope *event.Envelope) Delivery {
+	return Deliver(subscriber.Inject, subject, envelope)
+}
+
+//Deliver deliver envelope into message handler synchronously as message of subject
+func Deliver(handler event.MsgHandler, subject string, envelope *event.Envelope) Delivery {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return Delivery{Err: err}
+	}
+	var delivery Delivery
+	msg := event.NewMsg(subject, atomic.AddUint64(&sequence, 1), data, func() error {
+		delivery.Acked = true
+		return nil
+	})
+	handler(msg)
+	delivery.Err = msg.Err()
+	return delivery
+}
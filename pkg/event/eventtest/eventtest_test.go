@@ -0,0 +1,201 @@
+package eventtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/johnjerrico/gokit-starter-pack/pkg/event"
+	stan "github.com/nats-io/stan.go"
+)
+
+type account struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+//recordingT capture failures reported by expectations
+type recordingT struct {
+	testing.TB
+	failed bool
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.failed = true
+}
+
+//createAccount endpoint publishing account events into recorder, endpoint fails with err when it is not nil
+func createAccount(recorder *Recorder, err error) endpoint.Endpoint {
+	publisher := event.NewBrokerPublisher(recorder, log.NewNopLogger())
+	return publisher.Store("bank", "account", "create", "account", "test", func(ctx context.Context, request interface{}) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		return request, nil
+	}, func(data interface{}) interface{} { return data })
+}
+
+func TestRecorderExpectPublished(t *testing.T) {
+	recorder := NewRecorder()
+	defer recorder.Close()
+	request := account{ID: "1", Name: "alice"}
+	if _, err := createAccount(recorder, nil)(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.Published("account")) != 2 || len(recorder.Published("")) != 2 {
+		t.Fatalf("unexpected published envelopes %v", recorder.Published(""))
+	}
+	recorder.ExpectPublished(t, "account", event.StatusBegin, Any())
+	envelope := recorder.ExpectPublished(t, "account", event.StatusCommit, All(EventType("create"), Payload(&request)))
+	if envelope == nil || envelope.Domain != "bank" || envelope.Model != "account" {
+		t.Fatalf("unexpected commit envelope %+v", envelope)
+	}
+	recorder.ExpectNotPublished(t, "account", event.StatusError)
+
+	rt := &recordingT{TB: t}
+	if recorder.ExpectPublished(rt, "account", event.StatusCommit, Payload(account{ID: "2"})); !rt.failed {
+		t.Fatal("envelope with another payload is matched")
+	}
+	rt = &recordingT{TB: t}
+	if recorder.ExpectPublished(rt, "account", event.StatusCommit, EventType("update")); !rt.failed {
+		t.Fatal("envelope of another event type is matched")
+	}
+	rt = &recordingT{TB: t}
+	if recorder.ExpectNotPublished(rt, "account", event.StatusCommit); !rt.failed {
+		t.Fatal("published commit envelope is not reported")
+	}
+
+	recorder.Reset()
+	if published := recorder.Published(""); len(published) != 0 {
+		t.Fatalf("reset recorder still has %d envelopes", len(published))
+	}
+}
+
+func TestRecorderError(t *testing.T) {
+	recorder := NewRecorder()
+	defer recorder.Close()
+	if _, err := createAccount(recorder, errors.New("rejected"))(context.Background(), account{ID: "1"}); err == nil {
+		t.Fatal("endpoint error is not returned")
+	}
+	recorder.ExpectPublished(t, "account", event.StatusError, Payload("rejected"))
+	recorder.ExpectNotPublished(t, "account", event.StatusCommit)
+}
+
+func TestRecorderFailWith(t *testing.T) {
+	recorder := NewRecorder()
+	defer recorder.Close()
+	failure := errors.New("broker down")
+	recorder.FailWith(failure)
+	if err := recorder.Publish("account", []byte("{}")); err != failure {
+		t.Fatalf("publish returned %v, expected %v", err, failure)
+	}
+	if published := recorder.Published(""); len(published) != 0 {
+		t.Fatalf("failed publish is captured %v", published)
+	}
+
+	recorder.FailWith(nil)
+	if err := recorder.Publish("account", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if published := recorder.Published("account"); len(published) != 1 {
+		t.Fatalf("publish is not captured after failure is cleared, got %d", len(published))
+	}
+}
+
+func TestRecorderDeliversToSubscriber(t *testing.T) {
+	recorder := NewRecorder()
+	defer recorder.Close()
+	received := make(chan *event.Msg, 1)
+	sub, err := recorder.Subscribe("account", func(msg *event.Msg) { received <- msg }, event.SubscribeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	if err = recorder.Publish("account", []byte(`{"status":"commit"}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-received:
+		if string(msg.Data) != `{"status":"commit"}` {
+			t.Fatalf("subscriber received %s", msg.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message is not delivered to subscriber")
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	var handled account
+	handler := event.Handle(func(ctx context.Context, envelope *event.Envelope) error {
+		if envelope.EventType == "delete" {
+			return errors.New("not allowed")
+		}
+		return envelope.Decode(&handled)
+	})
+
+	delivery := Deliver(handler, "account", NewEnvelope("bank", "account", "create", event.StatusCommit, account{ID: "1", Name: "alice"}))
+	if !delivery.Acked || delivery.Err != nil {
+		t.Fatalf("unexpected delivery %+v", delivery)
+	}
+	if handled != (account{ID: "1", Name: "alice"}) {
+		t.Fatalf("handler decoded %+v", handled)
+	}
+
+	delivery = Deliver(handler, "account", NewEnvelope("bank", "account", "delete", event.StatusCommit, account{ID: "1"}))
+	if delivery.Acked || delivery.Err == nil {
+		t.Fatalf("failed delivery is reported as %+v", delivery)
+	}
+}
+
+func TestInject(t *testing.T) {
+	recorder := NewRecorder()
+	defer recorder.Close()
+	var eventTypes []string
+	subscriber := event.NewBrokerSubscriber(recorder, "account", "", "", "", log.NewNopLogger(), event.Handle(func(ctx context.Context, envelope *event.Envelope) error {
+		eventTypes = append(eventTypes, envelope.EventType)
+		return nil
+	}))
+
+	delivery := Inject(subscriber, "account", NewEnvelope("bank", "account", "create", event.StatusCommit, nil))
+	if !delivery.Acked || delivery.Err != nil {
+		t.Fatalf("unexpected delivery %+v", delivery)
+	}
+	if len(eventTypes) != 1 || eventTypes[0] != "create" {
+		t.Fatalf("subscriber handled %v", eventTypes)
+	}
+}
+
+func TestInjectStanHandler(t *testing.T) {
+	var handled []*stan.Msg
+	subscriber := event.NewSubscriber(nil, "account", "", "", "", log.NewNopLogger(), func(m *stan.Msg) {
+		handled = append(handled, m)
+	})
+
+	delivery := Inject(subscriber, "account", NewEnvelope("bank", "account", "create", event.StatusCommit, account{ID: "1"}))
+	if !delivery.Acked || delivery.Err != nil {
+		t.Fatalf("unexpected delivery %+v", delivery)
+	}
+	if len(handled) != 1 || handled[0].Subject != "account" {
+		t.Fatalf("stan handler received %v", handled)
+	}
+	envelope, err := event.UnmarshalEnvelope(handled[0].Data)
+	if err != nil || envelope.EventType != "create" {
+		t.Fatalf("stan handler received envelope %+v, err %v", envelope, err)
+	}
+
+	//stan message without subscription can not be acknowledged by handler
+	subscriber = event.NewSubscriber(nil, "account", "", "", "", log.NewNopLogger(), func(m *stan.Msg) {
+		m.Ack()
+	})
+	delivery = Inject(subscriber, "account", NewEnvelope("bank", "account", "create", event.StatusCommit, nil))
+	if delivery.Acked || delivery.Err == nil {
+		t.Fatalf("acknowledging injected stan message is reported as %+v", delivery)
+	}
+}
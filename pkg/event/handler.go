@@ -0,0 +1,109 @@
+package event
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/log"
+)
+
+//Handler handles incoming event envelope
+type Handler func(ctx context.Context, envelope *Envelope) error
+
+//HandlerOption sets optional parameter of envelope handler
+type HandlerOption func(*envelopeHandler)
+
+type envelopeHandler struct {
+	handler   Handler
+	upcasters *Upcasters
+	decryptor *FieldEncryptor
+	schemas   *Schemas
+	sequences *SequenceChecker
+	logger    log.Logger
+
+	deadLetterBroker  Broker
+	deadLetterSubject string
+}
+
+//HandlerUpcasters upcast envelope data into current schema version before it is handled
+func HandlerUpcasters(upcasters *Upcasters) HandlerOption {
+	return func(h *envelopeHandler) { h.upcasters = upcasters }
+}
+
+//HandlerDecryption decrypt payload fields selected by encryptor before envelope is handled, only transit keys accepted by encryptor are used
+func HandlerDecryption(encryptor *FieldEncryptor) HandlerOption {
+	return func(h *envelopeHandler) { h.decryptor = encryptor }
+}
+
+//HandlerLogger sets logger for decoding and handling errors
+func HandlerLogger(logger log.Logger) HandlerOption {
+	return func(h *envelopeHandler) { h.logger = logger }
+}
+
+//Handle wraps envelope handler into broker message handler, message is acknowledged only when handler succeed or it is dead-lettered
+func Handle(handler Handler, opts ...HandlerOption) MsgHandler {
+	h := newEnvelopeHandler(handler, opts)
+	return func(msg *Msg) {
+		if err := h.handle(context.Background(), msg.Data); err != nil && !h.deadLetter(msg, err) {
+			h.logger.Log("nats", "Error when handling message on channel: "+msg.Subject, "err", err)
+			msg.err = err
+			return
+		}
+		if err := msg.Ack(); err != nil {
+			h.logger.Log("nats", "Error when acknowledging message on channel: "+msg.Subject, "err", err)
+		}
+	}
+}
+
+func newEnvelopeHandler(handler Handler, opts []HandlerOption) *envelopeHandler {
+	h := &envelopeHandler{
+		handler: handler,
+		logger:  log.NewNopLogger(),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *envelopeHandler) handle(ctx context.Context, data []byte) error {
+	ctx, envelope, err := h.decode(ctx, data)
+	if err != nil {
+		return err
+	}
+	if h.sequences == nil {
+		return h.handler(ctx, envelope)
+	}
+	h.sequences.check(ctx, envelope)
+	if err = h.handler(ctx, envelope); err != nil {
+		return err
+	}
+	h.sequences.handled(envelope)
+	return nil
+}
+
+//decode decode, decompress, decrypt, validate and upcast envelope and restore its ids into context
+func (h *envelopeHandler) decode(ctx context.Context, data []byte) (context.Context, *Envelope, error) {
+	envelope, err := UnmarshalEnvelope(data)
+	if err != nil {
+		return ctx, nil, &invalidMessageError{err}
+	}
+	if err = envelope.Decompress(); err != nil {
+		return ctx, nil, err
+	}
+	if h.decryptor != nil {
+		if err = h.decryptor.Decrypt(ctx, envelope); err != nil {
+			return ctx, nil, err
+		}
+	}
+	if h.schemas != nil {
+		if err = h.schemas.Validate(envelope); err != nil {
+			return ctx, nil, &invalidMessageError{err}
+		}
+	}
+	if h.upcasters != nil {
+		if err = h.upcasters.Upcast(envelope); err != nil {
+			return ctx, nil, err
+		}
+	}
+	return envelope.Extract(ctx), envelope, nil
+}
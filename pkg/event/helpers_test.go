@@ -0,0 +1,63 @@
+package event
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//collect subscribe subject and send data of every message into returned channel
+func collect(t *testing.T, broker Broker, subject string, opts SubscribeOptions) (Subscription, chan *Msg) {
+	t.Helper()
+	received := make(chan *Msg, 100)
+	sub, err := broker.Subscribe(subject, func(msg *Msg) { received <- msg }, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sub, received
+}
+
+func receive(t *testing.T, received chan *Msg) *Msg {
+	t.Helper()
+	select {
+	case msg := <-received:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("message is not received")
+		return nil
+	}
+}
+
+func expectNone(t *testing.T, received chan *Msg) {
+	t.Helper()
+	select {
+	case msg := <-received:
+		t.Fatalf("unexpected message %s of %s", msg.Data, msg.Subject)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+//openDB open sqlite database in temporary directory of test
+func openDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	conn, err := sqlx.Open("sqlite3", "file:"+t.TempDir()+"/event.db?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+//eventually fails test when condition is not met within 5 seconds
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition is not met")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,104 @@
+package event
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+)
+
+//PublisherMetrics go-kit metrics of published envelopes, every metric is labelled with subject and status.
+//Nil metric is not recorded.
+type PublisherMetrics struct {
+	Published    metrics.Counter   //envelopes published
+	Failed       metrics.Counter   //envelopes failed to be encoded or published
+	Latency      metrics.Histogram //seconds spent publishing into broker
+	PayloadBytes metrics.Histogram //size of encoded envelope
+}
+
+//SubscriberMetrics go-kit metrics of received messages, every metric is labelled with subject.
+//Nil metric is not recorded.
+type SubscriberMetrics struct {
+	Received       metrics.Counter   //messages delivered to handler
+	Failed         metrics.Counter   //messages whose handler failed, reported by handlers built with Handle
+	Redelivered    metrics.Counter   //messages delivered more than once
+	HandlerLatency metrics.Histogram //seconds spent in handler
+	ConsumerLag    metrics.Histogram //seconds between publish and delivery
+}
+
+//PublisherInstrumentation record publisher metrics
+func PublisherInstrumentation(m PublisherMetrics) PublisherOption {
+	return func(p *Publisher) { p.metrics = m.withDefaults() }
+}
+
+//SubscriberInstrumentation record subscriber metrics
+func SubscriberInstrumentation(m SubscriberMetrics) SubscriberOption {
+	return func(s *Subscriber) { s.metrics = m.withDefaults() }
+}
+
+func (m PublisherMetrics) withDefaults() *PublisherMetrics {
+	if m.Published == nil {
+		m.Published = discard.NewCounter()
+	}
+	if m.Failed == nil {
+		m.Failed = discard.NewCounter()
+	}
+	if m.Latency == nil {
+		m.Latency = discard.NewHistogram()
+	}
+	if m.PayloadBytes == nil {
+		m.PayloadBytes = discard.NewHistogram()
+	}
+	return &m
+}
+
+func (m *PublisherMetrics) observe(subject, status string, size int, begin time.Time, err error) {
+	labels := []string{"subject", subject, "status", status}
+	if err != nil {
+		m.Failed.With(labels...).Add(1)
+		return
+	}
+	m.Published.With(labels...).Add(1)
+	m.Latency.With(labels...).Observe(time.Since(begin).Seconds())
+	m.PayloadBytes.With(labels...).Observe(float64(size))
+}
+
+func (m SubscriberMetrics) withDefaults() *SubscriberMetrics {
+	if m.Received == nil {
+		m.Received = discard.NewCounter()
+	}
+	if m.Failed == nil {
+		m.Failed = discard.NewCounter()
+	}
+	if m.Redelivered == nil {
+		m.Redelivered = discard.NewCounter()
+	}
+	if m.HandlerLatency == nil {
+		m.HandlerLatency = discard.NewHistogram()
+	}
+	if m.ConsumerLag == nil {
+		m.ConsumerLag = discard.NewHistogram()
+	}
+	return &m
+}
+
+func (m *SubscriberMetrics) instrument(next MsgHandler) MsgHandler {
+	return func(msg *Msg) {
+		begin := time.Now()
+		labels := []string{"subject", msg.Subject}
+		m.Received.With(labels...).Add(1)
+		if msg.Redelivered {
+			m.Redelivered.With(labels...).Add(1)
+		}
+		if msg.Timestamp > 0 {
+			m.ConsumerLag.With(labels...).Observe(begin.Sub(time.Unix(0, msg.Timestamp)).Seconds())
+		}
+
+		next(msg)
+
+		m.HandlerLatency.With(labels...).Observe(time.Since(begin).Seconds())
+		if msg.err != nil {
+			m.Failed.With(labels...).Add(1)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package event
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/johnjerrico/gokit-starter-pack/pkg/db"
+)
+
+//CheckpointTable table storing last processed sequence per projection
+const CheckpointTable = "event_checkpoints"
+
+const defaultProjectionAckWait = 30 * time.Second
+
+//ProjectionHandler apply envelope into read model within transaction, payload is decoded into new value of registered payload type
+type ProjectionHandler func(ctx context.Context, tx *sqlx.Tx, envelope *Envelope, payload interface{}) error
+
+type projectionRoute struct {
+	payload reflect.Type
+	handler ProjectionHandler
+}
+
+//Projection build read model from committed events of a subject.
+//Every envelope is applied and checkpointed in the same transaction, so restart resumes exactly after the last applied sequence.
+type Projection struct {
+	mu       sync.Mutex
+	name     string
+	broker   Broker
+	subject  string
+	db       *sqlx.DB
+	logger   log.Logger
+	decoder  *envelopeHandler
+	routes   map[string]projectionRoute
+	ackWait  time.Duration
+	last     uint64
+	sub      Subscription
+	stopping bool
+	//generation of current subscription, late delivery of previous subscription is ignored
+	generation uint64
+	inflight   sync.WaitGroup
+}
+
+//NewProjection create projection named name reading subject, handler options configure envelope decoding
+func NewProjection(name string, broker Broker, subject string, conn *sqlx.DB, logger log.Logger, opts ...HandlerOption) *Projection {
+	return &Projection{
+		name:    name,
+		broker:  broker,
+		subject: subject,
+		db:      conn,
+		logger:  logger,
+		decoder: newEnvelopeHandler(nil, opts),
+		routes:  make(map[string]projectionRoute),
+		ackWait: defaultProjectionAckWait,
+	}
+}
+
+//On register handler of model and event type, payload is a sample value of payload type or nil to skip decoding
+func (p *Projection) On(model, eventType string, payload interface{}, handler ProjectionHandler) *Projection {
+	route := projectionRoute{handler: handler}
+	if payload != nil {
+		route.payload = reflect.TypeOf(payload)
+		for route.payload.Kind() == reflect.Ptr {
+			route.payload = route.payload.Elem()
+		}
+	}
+	p.routes[model+"."+eventType] = route
+	return p
+}
+
+//Start create checkpoint table if needed and subscribe subject after the last checkpoint, started projection must be stopped first
+func (p *Projection) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sub != nil {
+		return fmt.Errorf("projection %s is already started", p.name)
+	}
+	if err := EnsureCheckpointTable(p.db); err != nil {
+		return err
+	}
+	last, err := p.checkpoint()
+	if err != nil {
+		return err
+	}
+	p.last = last
+	p.stopping = false
+	p.generation++
+	generation := p.generation
+
+	sub, err := p.broker.Subscribe(p.subject, func(msg *Msg) { p.handle(generation, msg) }, SubscribeOptions{
+		Start:       StartPosition{Kind: StartSequence, Sequence: last + 1},
+		ManualAck:   true,
+		AckWait:     p.ackWait,
+		MaxInflight: 1,
+	})
+	if err != nil {
+		return err
+	}
+	p.sub = sub
+	p.logger.Log("projection", fmt.Sprintf("Projection %s subscribed topic %s after sequence %d", p.name, p.subject, last))
+	return nil
+}
+
+//Stop stop projecting events and wait for the envelope being projected
+func (p *Projection) Stop() error {
+	p.mu.Lock()
+	p.stopping = true
+	var err error
+	if p.sub != nil {
+		err = p.sub.Unsubscribe()
+		p.sub = nil
+	}
+	p.mu.Unlock()
+
+	p.inflight.Wait()
+	return err
+}
+
+//Rebuild stop projection, reset read model and checkpoint within one transaction and project again from the first sequence
+func (p *Projection) Rebuild(reset func(tx *sqlx.Tx) error) error {
+	if err := p.Stop(); err != nil {
+		return err
+	}
+	if err := EnsureCheckpointTable(p.db); err != nil {
+		return err
+	}
+	err := db.RunInNewTransaction(context.Background(), p.db, func(_ context.Context, tx *sqlx.Tx) error {
+		if reset != nil {
+			if err := reset(tx); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(tx.Rebind("DELETE FROM "+CheckpointTable+" WHERE name = ?"), p.name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return p.Start()
+}
+
+type projectionSink struct {
+	projection *Projection
+}
+
+//NewProjectionSink feed replayed or restored records into projection, records at or before its checkpoint are skipped.
+//Projection must not be started while sink is written, Start afterwards continues after the last written sequence.
+func NewProjectionSink(p *Projection) (ReplaySink, error) {
+	if err := EnsureCheckpointTable(p.db); err != nil {
+		return nil, err
+	}
+	last, err := p.checkpoint()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.last = last
+	p.mu.Unlock()
+	return &projectionSink{projection: p}, nil
+}
+
+func (s *projectionSink) Write(record Record) error {
+	s.projection.mu.Lock()
+	last := s.projection.last
+	s.projection.mu.Unlock()
+	if record.Sequence <= last {
+		return nil
+	}
+	return s.projection.project(&Msg{Subject: record.Subject, Sequence: record.Sequence, Timestamp: record.Timestamp, Data: record.Envelope})
+}
+
+func (s *projectionSink) Close() error {
+	return nil
+}
+
+//EnsureCheckpointTable create checkpoint table when it does not exist
+func EnsureCheckpointTable(conn *sqlx.DB) error {
+	_, err := conn.Exec("CREATE TABLE IF NOT EXISTS " + CheckpointTable + " (name VARCHAR(255) NOT NULL PRIMARY KEY, sequence BIGINT NOT NULL)")
+	return err
+}
+
+func (p *Projection) checkpoint() (uint64, error) {
+	var sequence int64
+	err := p.db.Get(&sequence, p.db.Rebind("SELECT sequence FROM "+CheckpointTable+" WHERE name = ?"), p.name)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return uint64(sequence), err
+}
+
+func (p *Projection) handle(generation uint64, msg *Msg) {
+	p.mu.Lock()
+	last, stopping := p.last, p.stopping || generation != p.generation
+	if !stopping {
+		p.inflight.Add(1)
+	}
+	p.mu.Unlock()
+	if stopping {
+		return
+	}
+	defer p.inflight.Done()
+	if msg.Sequence <= last {
+		msg.Ack()
+		return
+	}
+
+	if err := p.project(msg); err != nil {
+		p.logger.Log("projection", fmt.Sprintf("Error when projecting sequence %d of topic %s into %s", msg.Sequence, p.subject, p.name), "err", err)
+		msg.err = err
+		return
+	}
+	if err := msg.Ack(); err != nil {
+		p.logger.Log("projection", fmt.Sprintf("Error when acknowledging sequence %d of topic %s", msg.Sequence, p.subject), "err", err)
+	}
+}
+
+//project apply message and save its sequence as checkpoint within one transaction, dead-lettered message is only checkpointed
+func (p *Projection) project(msg *Msg) error {
+	ctx, envelope, err := p.decoder.decode(context.Background(), msg.Data)
+	if err != nil && !p.decoder.deadLetter(msg, err) {
+		return err
+	}
+	err = db.RunInNewTransaction(ctx, p.db, func(ctx context.Context, tx *sqlx.Tx) error {
+		if envelope != nil {
+			if err := p.apply(ctx, tx, envelope); err != nil {
+				return err
+			}
+			//checked after apply succeeds, so redelivery of failed envelope is reported once
+			if p.decoder.sequences != nil {
+				p.decoder.sequences.check(ctx, envelope)
+			}
+		}
+		return saveCheckpoint(tx, p.name, msg.Sequence)
+	})
+	if err != nil {
+		return err
+	}
+	if envelope != nil && p.decoder.sequences != nil {
+		p.decoder.sequences.handled(envelope)
+	}
+	p.mu.Lock()
+	p.last = msg.Sequence
+	p.mu.Unlock()
+	return nil
+}
+
+//apply dispatch committed envelope into registered handler, other envelopes are only checkpointed
+func (p *Projection) apply(ctx context.Context, tx *sqlx.Tx, envelope *Envelope) error {
+	if envelope.Status != StatusCommit {
+		return nil
+	}
+	route, ok := p.routes[envelope.Model+"."+envelope.EventType]
+	if !ok {
+		return nil
+	}
+	var payload interface{}
+	if route.payload != nil {
+		payload = reflect.New(route.payload).Interface()
+		if err := envelope.Decode(payload); err != nil {
+			return err
+		}
+	}
+	return route.handler(ctx, tx, envelope, payload)
+}
+
+func saveCheckpoint(tx *sqlx.Tx, name string, sequence uint64) error {
+	res, err := tx.Exec(tx.Rebind("UPDATE "+CheckpointTable+" SET sequence = ? WHERE name = ?"), int64(sequence), name)
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected > 0 {
+		return err
+	}
+	_, err = tx.Exec(tx.Rebind("INSERT INTO "+CheckpointTable+" (name, sequence) VALUES (?, ?)"), name, int64(sequence))
+	return err
+}
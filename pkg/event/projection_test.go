@@ -0,0 +1,125 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+)
+
+type projectedUser struct {
+	Name string `json:"name"`
+}
+
+func TestProjectionCheckpointResume(t *testing.T) {
+	conn := openDB(t)
+	conn.MustExec("CREATE TABLE users (name TEXT)")
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	publisher := NewBrokerPublisher(broker, log.NewNopLogger())
+	create := publisher.Store("account", "user", "create", "user", "test", func(ctx context.Context, request interface{}) (interface{}, error) {
+		return request, nil
+	}, func(data interface{}) interface{} { return data })
+	users := func() []string {
+		var names []string
+		if err := conn.Select(&names, "SELECT name FROM users ORDER BY name"); err != nil {
+			t.Fatal(err)
+		}
+		return names
+	}
+
+	failures := int32(1)
+	newProjection := func() *Projection {
+		p := NewProjection("users", broker, "user", conn, log.NewNopLogger()).On("user", "create", projectedUser{}, func(ctx context.Context, tx *sqlx.Tx, envelope *Envelope, payload interface{}) error {
+			user := payload.(*projectedUser)
+			if user.Name == "carol" && atomic.AddInt32(&failures, -1) >= 0 {
+				return errors.New("read model unavailable")
+			}
+			_, err := tx.Exec("INSERT INTO users (name) VALUES (?)", user.Name)
+			return err
+		})
+		p.ackWait = 50 * time.Millisecond
+		return p
+	}
+
+	create(context.Background(), projectedUser{Name: "alice"})
+	create(context.Background(), projectedUser{Name: "bob"})
+	projection := newProjection()
+	if err := projection.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := projection.Start(); err == nil {
+		t.Fatal("started projection is started again")
+	}
+	eventually(t, func() bool { return len(users()) == 2 })
+	//begin and commit envelope of both requests are checkpointed
+	eventually(t, func() bool {
+		last, err := projection.checkpoint()
+		return err == nil && last == 4
+	})
+	if err := projection.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	//restarted projection resumes after checkpoint and retries failed envelope without applying it twice
+	create(context.Background(), projectedUser{Name: "carol"})
+	projection = newProjection()
+	if err := projection.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer projection.Stop()
+	eventually(t, func() bool { return len(users()) == 3 })
+	time.Sleep(100 * time.Millisecond)
+	if names := users(); len(names) != 3 || names[0] != "alice" || names[1] != "bob" || names[2] != "carol" {
+		t.Fatalf("read model is %v", names)
+	}
+	if atomic.LoadInt32(&failures) >= 0 {
+		t.Fatal("failing envelope is not retried")
+	}
+}
+
+func TestProjectionRebuild(t *testing.T) {
+	conn := openDB(t)
+	conn.MustExec("CREATE TABLE users (name TEXT)")
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	publisher := NewBrokerPublisher(broker, log.NewNopLogger())
+	create := publisher.Store("account", "user", "create", "user", "test", func(ctx context.Context, request interface{}) (interface{}, error) {
+		return request, nil
+	}, func(data interface{}) interface{} { return data })
+	create(context.Background(), projectedUser{Name: "alice"})
+
+	var applied int32
+	projection := NewProjection("users", broker, "user", conn, log.NewNopLogger()).On("user", "create", projectedUser{}, func(ctx context.Context, tx *sqlx.Tx, envelope *Envelope, payload interface{}) error {
+		atomic.AddInt32(&applied, 1)
+		_, err := tx.Exec("INSERT INTO users (name) VALUES (?)", payload.(*projectedUser).Name)
+		return err
+	})
+	if err := projection.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer projection.Stop()
+	count := func() int {
+		var n int
+		if err := conn.Get(&n, "SELECT COUNT(*) FROM users"); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	eventually(t, func() bool { return count() == 1 })
+
+	if err := projection.Rebuild(func(tx *sqlx.Tx) error {
+		_, err := tx.Exec("DELETE FROM users")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool { return atomic.LoadInt32(&applied) == 2 })
+	if n := count(); n != 1 {
+		t.Fatalf("rebuilt read model has %d rows", n)
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+	"github.com/nats-io/nats.go/jetstream"
 	stan "github.com/nats-io/stan.go"
 )
 
@@ -15,96 +18,292 @@ type MetaBuilder func(data interface{}) interface{}
 
 // Publisher wraps a URL and provides a method that implements endpoint.Endpoint.
 type Publisher struct {
-	publisher stan.Conn
+	publisher Broker
 	logger    log.Logger
+	upcasters *Upcasters
+
+	beginBuilder MetaBuilder
+
+	codec         Codec
+	compressor    Compressor
+	compressAbove int
+	maxPayload    int
+
+	routes  Routes
+	metrics *PublisherMetrics
+
+	schemas    *Schemas
+	validation ValidationMode
+
+	catalog     *Catalog
+	cloudEvents bool
+
+	sequencer   Sequencer
+	sequenceKey PartitionKey
+
+	encryptor *FieldEncryptor
+}
+
+//PublisherOption sets optional parameter of Publisher
+type PublisherOption func(*Publisher)
+
+//PublisherUpcasters stamps published envelope with current schema version known by upcasters
+func PublisherUpcasters(upcasters *Upcasters) PublisherOption {
+	return func(p *Publisher) { p.upcasters = upcasters }
+}
+
+//PublisherBeginBuilder build request data before it is published with status begin, endpoint still receives original request
+func PublisherBeginBuilder(metaBuilder MetaBuilder) PublisherOption {
+	return func(p *Publisher) { p.beginBuilder = metaBuilder }
+}
+
+//PublisherCodec encode request and response payload with codec, default is json
+func PublisherCodec(codec Codec) PublisherOption {
+	return func(p *Publisher) { p.codec = codec }
+}
+
+//PublisherCompression compress payload larger than threshold bytes
+func PublisherCompression(compressor Compressor, threshold int) PublisherOption {
+	return func(p *Publisher) {
+		p.compressor = compressor
+		p.compressAbove = threshold
+	}
+}
+
+//PublisherMaxPayload reject envelope larger than size bytes with PAYLOADTOOLARGE error before publishing.
+//Too large begin rejects request before endpoint runs, too large commit is not published and endpoint returns the error instead of its response.
+func PublisherMaxPayload(size int) PublisherOption {
+	return func(p *Publisher) { p.maxPayload = size }
+}
+
+//PublisherRoute publish envelope of status into subject template instead of subject given to Store, empty subject suppresses the status
+func PublisherRoute(status, subject string) PublisherOption {
+	return func(p *Publisher) {
+		if p.routes == nil {
+			p.routes = make(Routes)
+		}
+		p.routes[status] = subject
+	}
+}
+
+//PublisherValidation validate envelope against its schema before publishing.
+//With ValidationReject invalid begin rejects request before endpoint runs. Invalid commit is not published and endpoint
+//returns the UNPROCESSABLEENTITY error instead of its response, side effects of endpoint have already happened.
+func PublisherValidation(schemas *Schemas, mode ValidationMode) PublisherOption {
+	return func(p *Publisher) {
+		p.schemas = schemas
+		p.validation = mode
+	}
+}
+
+//PublisherEncryption encrypt fields selected by encryptor in begin and commit payload, data failing encryption is never published in plaintext
+func PublisherEncryption(encryptor *FieldEncryptor) PublisherOption {
+	return func(p *Publisher) { p.encryptor = encryptor }
 }
 
 //NewPublisher to create new Publisher
-func NewPublisher(conn stan.Conn, logger log.Logger) *Publisher {
+func NewPublisher(conn stan.Conn, logger log.Logger, opts ...PublisherOption) *Publisher {
+	return NewBrokerPublisher(NewStanBroker(conn), logger, opts...)
+}
+
+//NewJetStreamPublisher to create new Publisher publishing into jetstream stream
+func NewJetStreamPublisher(js jetstream.JetStream, stream string, logger log.Logger, opts ...PublisherOption) *Publisher {
+	return NewBrokerPublisher(NewJetStreamBroker(js, stream), logger, opts...)
+}
 
-	return &Publisher{
-		publisher: conn,
+//NewBrokerPublisher to create new Publisher publishing through broker
+func NewBrokerPublisher(broker Broker, logger log.Logger, opts ...PublisherOption) *Publisher {
+	p := &Publisher{
+		publisher: broker,
 		logger:    logger,
+		codec:     JSONCodec{},
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	return p
 }
 
-//Store for publish event (begin and commit) to nats and data wrapping as a middleware
-func (p *Publisher) Store(domain, model, eventType, subject, eventSource string, f endpoint.Endpoint, metabuilder MetaBuilder) endpoint.Endpoint {
+//Store for publish event (begin and commit) to nats and data wrapping as a middleware.
+//Subject may be a template rendered by RenderSubject, routes of publisher and store options select subject per status.
+func (p *Publisher) Store(domain, model, eventType, subject, eventSource string, f endpoint.Endpoint, metabuilder MetaBuilder, opts ...StoreOption) endpoint.Endpoint {
+	options := storeOptions{routes: Routes{StatusBegin: subject, StatusCommit: subject, StatusError: subject}}
+	for status, template := range p.routes {
+		options.routes[status] = template
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	subjects := p.subjects(domain, model, eventType, eventSource, options.routes)
+	if p.catalog != nil {
+		p.register(domain, model, eventType, eventSource, subjects, options)
+	}
 	return func(ctx context.Context, request interface{}) (response interface{}, errResponse error) {
-		var requestData map[string]interface{}
-		var requestBundle = make(map[string]interface{})
-		data, err := json.Marshal(request)
-		if err != nil {
-			return nil, err
-		}
-		if err = json.Unmarshal(data, &requestData); err != nil {
-			return nil, err
-		}
-
-		requestBundle["domain"] = domain
-		requestBundle["model"] = model
-		requestBundle["status"] = "begin"
-		requestBundle["event_type"] = eventType
-		requestBundle["event_source"] = eventSource
-		requestBundle["data"] = requestData
-		dataBundle, err := json.Marshal(requestBundle)
-		if err != nil {
-			return nil, err
+		if subject := subjects[StatusBegin]; subject != "" {
+			requestData := request
+			if p.beginBuilder != nil {
+				requestData = p.beginBuilder(request)
+			}
+			dataBundle, err := p.bundle(ctx, domain, model, StatusBegin, eventType, subject, eventSource, p.codec, requestData)
+			if err != nil {
+				return nil, rejectionCause(err)
+			}
+			if err = p.send(subject, StatusBegin, dataBundle); err != nil {
+				p.logger.Log("error_publish_begin", err)
+			}
 		}
-		p.publisher.Publish(subject, dataBundle)
-		p.logger.Log("nats", "Published message on channel: "+subject)
-		p.logger.Log("nats", fmt.Sprintf("data : %s", requestBundle))
 
 		defer func() {
 			if errResponse == nil {
-				var resultData map[string]interface{}
-				var resultBundle = make(map[string]interface{})
-				buildData := metabuilder(response)
-				dataResult, err := json.Marshal(buildData)
-				if err != nil {
-					p.logger.Log("error_publish_commit", err)
+				if subject := subjects[StatusCommit]; subject != "" {
+					if err := p.publish(ctx, domain, model, StatusCommit, eventType, subject, eventSource, p.codec, metabuilder(response)); err != nil {
+						p.logger.Log("error_publish_commit", err)
+						if rejected, ok := err.(*rejectedError); ok {
+							response, errResponse = nil, rejected.err
+						}
+					}
 				}
-
-				if err = json.Unmarshal(dataResult, &resultData); err != nil {
-					p.logger.Log("error_publish_commit", err)
+			} else {
+				if subject := subjects[StatusError]; subject != "" {
+					if err := p.publish(ctx, domain, model, StatusError, eventType, subject, eventSource, JSONCodec{}, errResponse.Error()); err != nil {
+						p.logger.Log("error_publish_event_error", err)
+					}
 				}
+			}
+		}()
 
-				resultBundle["domain"] = domain
-				resultBundle["model"] = model
-				resultBundle["status"] = "commit"
-				resultBundle["event_type"] = eventType
-				requestBundle["event_source"] = eventSource
-				resultBundle["data"] = resultData
+		return f(ctx, request)
+	}
+}
 
-				dataBundle, err := json.Marshal(resultBundle)
-				if err != nil {
-					p.logger.Log("error_publish_commit", err)
-				}
-				p.publisher.Publish(subject, dataBundle)
-				p.logger.Log("nats", "Published message on channel: "+subject)
-				p.logger.Log("nats", fmt.Sprintf("data : %s", resultBundle))
-			} else {
-				var resultBundle = make(map[string]interface{})
-
-				resultBundle["domain"] = domain
-				resultBundle["model"] = model
-				resultBundle["status"] = "error"
-				resultBundle["event_type"] = eventType
-				requestBundle["event_source"] = eventSource
-				resultBundle["data"] = errResponse.Error()
-
-				dataBundle, err := json.Marshal(resultBundle)
-				if err != nil {
-					p.logger.Log("error_publish_event_error", err)
-				}
-				p.publisher.Publish(subject, dataBundle)
+//subjects render subject of every status, empty subject means envelope of the status is not published
+func (p *Publisher) subjects(domain, model, eventType, eventSource string, templates Routes) Routes {
+	routes := make(Routes, len(templates))
+	for status, template := range templates {
+		envelope := &Envelope{
+			Domain:      domain,
+			Model:       model,
+			Status:      status,
+			EventType:   eventType,
+			EventSource: eventSource,
+		}
+		if p.upcasters != nil {
+			envelope.SchemaVersion = p.upcasters.Current(domain, model, eventType)
+		}
+		routes[status] = RenderSubject(template, envelope)
+	}
+	return routes
+}
 
-				p.logger.Log("nats", "Published message on channel: "+subject)
-				p.logger.Log("nats", fmt.Sprintf("data : %s", resultBundle))
+func (p *Publisher) publish(ctx context.Context, domain, model, status, eventType, subject, eventSource string, codec Codec, data interface{}) error {
+	dataBundle, err := p.bundle(ctx, domain, model, status, eventType, subject, eventSource, codec, data)
+	if err != nil {
+		return err
+	}
+	return p.send(subject, status, dataBundle)
+}
 
+//bundle build and encode envelope, failure is recorded as failed publish
+func (p *Publisher) bundle(ctx context.Context, domain, model, status, eventType, subject, eventSource string, codec Codec, data interface{}) ([]byte, error) {
+	envelope, err := p.envelope(ctx, domain, model, status, eventType, eventSource, codec, data)
+	if err == nil && p.schemas != nil {
+		if verr := p.schemas.Validate(envelope); verr != nil {
+			if p.validation == ValidationReject {
+				err = &rejectedError{err: verr}
+			} else {
+				p.logger.Log("error_validate_event", verr, "subject", subject, "status", status)
 			}
-		}()
+		}
+	}
+	if err == nil {
+		sequenced := p.sequencer != nil && p.reserveSequence(envelope)
+		var dataBundle []byte
+		if dataBundle, err = p.encode(envelope); err == nil && sequenced {
+			//sequence is allocated only for envelope which is valid and fits, so rejected envelope leaves no gap
+			p.sequence(ctx, envelope)
+			dataBundle, err = p.encode(envelope)
+		}
+		if err == nil {
+			return dataBundle, nil
+		}
+	}
+	if p.metrics != nil {
+		p.metrics.observe(subject, status, 0, time.Time{}, err)
+	}
+	return nil, err
+}
 
-		return f(ctx, request)
+func (p *Publisher) envelope(ctx context.Context, domain, model, status, eventType, eventSource string, codec Codec, data interface{}) (*Envelope, error) {
+	envelope := &Envelope{
+		Domain:        domain,
+		Model:         model,
+		Status:        status,
+		EventType:     eventType,
+		EventSource:   eventSource,
+		SchemaVersion: 1,
+	}
+	if p.upcasters != nil {
+		envelope.SchemaVersion = p.upcasters.Current(domain, model, eventType)
+	}
+	envelope.Inject(ctx)
+
+	if p.encryptor != nil && status != StatusError {
+		encrypted, err := p.encryptor.Encrypt(ctx, data)
+		if err != nil {
+			return nil, err
+		}
+		data = encrypted
+	}
+	payload, err := codec.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var encoding string
+	if p.compressor != nil && len(payload) > p.compressAbove {
+		if payload, err = p.compressor.Compress(payload); err != nil {
+			return nil, err
+		}
+		encoding = p.compressor.Encoding()
+	}
+	if err = envelope.SetPayload(payload, codec.ContentType(), encoding); err != nil {
+		return nil, err
+	}
+	return envelope, nil
+}
+
+func (p *Publisher) encode(envelope *Envelope) ([]byte, error) {
+	var message interface{} = envelope
+	if p.cloudEvents {
+		event, err := NewCloudEvent(envelope)
+		if err != nil {
+			return nil, err
+		}
+		message = event
+	}
+	dataBundle, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	if p.maxPayload > 0 && len(dataBundle) > p.maxPayload {
+		return nil, &rejectedError{err: rError.New(
+			fmt.Errorf("payload of %d bytes exceeds maximum %d bytes", len(dataBundle), p.maxPayload),
+			rError.Enum.PAYLOADTOOLARGE,
+			"payload_too_large",
+		)}
+	}
+	return dataBundle, nil
+}
+
+func (p *Publisher) send(subject, status string, dataBundle []byte) error {
+	begin := time.Now()
+	err := p.publisher.Publish(subject, dataBundle)
+	if p.metrics != nil {
+		p.metrics.observe(subject, status, len(dataBundle), begin, err)
+	}
+	if err != nil {
+		return err
 	}
+	p.logger.Log("nats", "Published message on channel: "+subject)
+	p.logger.Log("nats", fmt.Sprintf("data : %s", dataBundle))
+	return nil
 }
@@ -0,0 +1,62 @@
+package event
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+)
+
+func TestPublisherMaxPayload(t *testing.T) {
+	large := strings.Repeat("x", 512)
+	tests := []struct {
+		name     string
+		request  string
+		response string
+		called   bool
+		rejected bool
+		statuses []string
+	}{
+		{name: "fits", request: "small", response: "small", called: true, statuses: []string{StatusBegin, StatusCommit}},
+		{name: "begin too large", request: large, response: "small", rejected: true},
+		{name: "commit too large", request: "small", response: large, called: true, rejected: true, statuses: []string{StatusBegin}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker := NewMemoryBroker()
+			defer broker.Close()
+			publisher := NewBrokerPublisher(broker, log.NewNopLogger(), PublisherMaxPayload(256))
+			called := false
+			endpoint := publisher.Store("bank", "account", "create", "account", "test", func(ctx context.Context, request interface{}) (interface{}, error) {
+				called = true
+				return test.response, nil
+			}, func(data interface{}) interface{} { return data })
+
+			response, err := endpoint(context.Background(), test.request)
+			if called != test.called {
+				t.Fatalf("endpoint called is %v, expected %v", called, test.called)
+			}
+			if test.rejected {
+				rerr, ok := err.(*rError.Error)
+				if !ok || rerr.Kind() != rError.Enum.PAYLOADTOOLARGE || response != nil {
+					t.Fatalf("endpoint returned %v, %v, expected PAYLOADTOOLARGE", response, err)
+				}
+			} else if err != nil || response != test.response {
+				t.Fatalf("endpoint returned %v, %v", response, err)
+			}
+
+			messages := broker.Messages("account")
+			if len(messages) != len(test.statuses) {
+				t.Fatalf("published %d envelopes, expected %d", len(messages), len(test.statuses))
+			}
+			for i, msg := range messages {
+				envelope, err := UnmarshalEnvelope(msg.Data)
+				if err != nil || envelope.Status != test.statuses[i] {
+					t.Fatalf("envelope %d is %+v, %v, expected status %s", i, envelope, err, test.statuses[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package event
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+//Record message stored outside of broker, one json object per line in jsonl files
+type Record struct {
+	Subject   string          `json:"subject"`
+	Sequence  uint64          `json:"sequence"`
+	Timestamp int64           `json:"timestamp"`
+	Envelope  json.RawMessage `json:"envelope"`
+}
+
+//NewRecord create record of broker message
+func NewRecord(msg *Msg) Record {
+	return Record{
+		Subject:   msg.Subject,
+		Sequence:  msg.Sequence,
+		Timestamp: msg.Timestamp,
+		Envelope:  msg.Data,
+	}
+}
+
+//ReplayFilter select messages to replay, empty field matches everything
+type ReplayFilter struct {
+	Domains      []string
+	Models       []string
+	EventTypes   []string
+	Statuses     []string
+	FromSequence uint64
+	ToSequence   uint64
+	FromTime     time.Time
+	ToTime       time.Time
+}
+
+//Start return subscription start position of filter
+func (f ReplayFilter) Start() StartPosition {
+	if f.FromSequence > 0 {
+		return StartPosition{Kind: StartSequence, Sequence: f.FromSequence}
+	}
+	if !f.FromTime.IsZero() {
+		return StartPosition{Kind: StartTime, Time: f.FromTime}
+	}
+	return StartPosition{Kind: StartAll}
+}
+
+//Done return true when message is past the end of range
+func (f ReplayFilter) Done(msg *Msg) bool {
+	if f.ToSequence > 0 && msg.Sequence > f.ToSequence {
+		return true
+	}
+	return !f.ToTime.IsZero() && msg.Timestamp > f.ToTime.UnixNano()
+}
+
+//Match return true when envelope matches domain, model, event type and status
+func (f ReplayFilter) Match(envelope *Envelope) bool {
+	return matchAny(f.Domains, envelope.Domain) &&
+		matchAny(f.Models, envelope.Model) &&
+		matchAny(f.EventTypes, envelope.EventType) &&
+		matchAny(f.Statuses, envelope.Status)
+}
+
+func matchAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+//ReplaySink destination of replayed messages
+type ReplaySink interface {
+	Write(record Record) error
+	Close() error
+}
+
+//ReplayStats summary of replay
+type ReplayStats struct {
+	Received int
+	Replayed int
+	Skipped  int
+	Invalid  int
+}
+
+//Replay subscribe subject and write messages matching filter into sink
+//until end of range is reached, no message arrives for idle duration (when positive) or context is done
+func Replay(ctx context.Context, broker Broker, subject string, filter ReplayFilter, sink ReplaySink, idle time.Duration) (ReplayStats, error) {
+	var stats ReplayStats
+	msgs := make(chan *Msg, 64)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	sub, err := broker.Subscribe(subject, func(msg *Msg) {
+		select {
+		case msgs <- msg:
+		case <-stop:
+		}
+	}, SubscribeOptions{Start: filter.Start()})
+	if err != nil {
+		return stats, err
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		var timeout <-chan time.Time
+		if idle > 0 {
+			timeout = time.After(idle)
+		}
+		select {
+		case <-ctx.Done():
+			return stats, ctx.Err()
+		case <-timeout:
+			return stats, nil
+		case msg := <-msgs:
+			if filter.Done(msg) {
+				return stats, nil
+			}
+			stats.Received++
+			envelope, err := UnmarshalEnvelope(msg.Data)
+			if err != nil {
+				stats.Invalid++
+				continue
+			}
+			if !filter.Match(envelope) {
+				stats.Skipped++
+				continue
+			}
+			if err = sink.Write(NewRecord(msg)); err != nil {
+				return stats, err
+			}
+			stats.Replayed++
+		}
+	}
+}
+
+type subjectSink struct {
+	broker  Broker
+	subject string
+}
+
+//NewSubjectSink republish replayed envelope into subject
+func NewSubjectSink(broker Broker, subject string) ReplaySink {
+	return &subjectSink{broker: broker, subject: subject}
+}
+
+func (s *subjectSink) Write(record Record) error {
+	return s.broker.Publish(s.subject, record.Envelope)
+}
+
+func (s *subjectSink) Close() error {
+	return nil
+}
+
+type writerSink struct {
+	w      *bufio.Writer
+	closer io.Closer
+}
+
+//NewWriterSink write replayed record as json line into writer
+func NewWriterSink(w io.Writer) ReplaySink {
+	return &writerSink{w: bufio.NewWriter(w)}
+}
+
+//NewFileSink write replayed record as json line into local file, existing file is appended
+func NewFileSink(path string) (ReplaySink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &writerSink{w: bufio.NewWriter(f), closer: f}, nil
+}
+
+func (s *writerSink) Write(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err = s.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *writerSink) Close() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+type httpSink struct {
+	client *http.Client
+	url    string
+}
+
+//NewHTTPSink post replayed envelope into http endpoint, non 2xx response fails the replay
+func NewHTTPSink(client *http.Client, url string) ReplaySink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &httpSink{client: client, url: url}
+}
+
+func (s *httpSink) Write(record Record) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(record.Envelope))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentTypeJSON)
+	req.Header.Set("X-Event-Subject", record.Subject)
+	req.Header.Set("X-Event-Sequence", strconv.FormatUint(record.Sequence, 10))
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("replay of sequence %d to %s failed with status %s", record.Sequence, s.url, res.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	return nil
+}
@@ -0,0 +1,138 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+//PayloadHandler handles envelope with its payload decoded into pointer to new value of route payload type
+type PayloadHandler func(ctx context.Context, envelope *Envelope, payload interface{}) error
+
+//Router dispatch envelopes of one subscription into handlers registered by domain.model.event_type.status pattern.
+//Pattern segment * matches any value and trailing > matches every remaining segment, ex: account.user.*.commit, account.>.
+//Routes are matched in registration order, the first matching route handles envelope.
+//Use Router.Handle as handler of Handle, ex: event.Handle(router.Handle, event.HandlerUpcasters(upcasters)).
+type Router struct {
+	mu       sync.RWMutex
+	routes   []route
+	fallback Handler
+}
+
+type route struct {
+	pattern []string
+	handler Handler
+}
+
+//NewRouter create router without routes, unmatched envelopes are ignored until Default is set
+func NewRouter() *Router {
+	return &Router{}
+}
+
+//Route register handler of envelopes matching pattern, it fails when pattern is invalid
+func (r *Router) Route(pattern string, handler Handler) error {
+	segments, err := parseRoutePattern(pattern)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes = append(r.routes, route{pattern: segments, handler: handler})
+	return nil
+}
+
+//MustRoute register handler like Route and return router for chaining, it panics when pattern is invalid
+func (r *Router) MustRoute(pattern string, handler Handler) *Router {
+	if err := r.Route(pattern, handler); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+//RoutePayload register handler of envelopes matching pattern whose payload is decoded into new value of payload type,
+//ex: router.RoutePayload("account.user.create.commit", User{}, func(ctx context.Context, envelope *event.Envelope, payload interface{}) error { user := payload.(*User) }).
+//Payload which can not be decoded is rejected as invalid message, so it is dead-lettered when handler has dead-letter subject.
+//It fails when pattern is invalid or payload is nil.
+func (r *Router) RoutePayload(pattern string, payload interface{}, handler PayloadHandler) error {
+	t := reflect.TypeOf(payload)
+	if t == nil {
+		return fmt.Errorf("route %s has nil payload type", pattern)
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return r.Route(pattern, func(ctx context.Context, envelope *Envelope) error {
+		value := reflect.New(t).Interface()
+		if err := envelope.Decode(value); err != nil {
+			return &invalidMessageError{fmt.Errorf("decode %s.%s.%s payload into %s: %w", envelope.Domain, envelope.Model, envelope.EventType, t, err)}
+		}
+		return handler(ctx, envelope, value)
+	})
+}
+
+//MustRoutePayload register handler like RoutePayload and return router for chaining, it panics when pattern is invalid or payload is nil
+func (r *Router) MustRoutePayload(pattern string, payload interface{}, handler PayloadHandler) *Router {
+	if err := r.RoutePayload(pattern, payload, handler); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+//Default sets handler of envelopes matching no route
+func (r *Router) Default(handler Handler) *Router {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = handler
+	return r
+}
+
+//Handle dispatch envelope into handler of the first matching route
+func (r *Router) Handle(ctx context.Context, envelope *Envelope) error {
+	values := []string{envelope.Domain, envelope.Model, envelope.EventType, envelope.Status}
+	r.mu.RLock()
+	handler := r.fallback
+	for _, route := range r.routes {
+		if matchRoute(route.pattern, values) {
+			handler = route.handler
+			break
+		}
+	}
+	r.mu.RUnlock()
+	if handler == nil {
+		return nil
+	}
+	return handler(ctx, envelope)
+}
+
+func parseRoutePattern(pattern string) ([]string, error) {
+	segments := strings.Split(pattern, ".")
+	for i, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("route pattern %q has empty segment", pattern)
+		}
+		if segment == ">" && i != len(segments)-1 {
+			return nil, fmt.Errorf("route pattern %q has > before its last segment", pattern)
+		}
+	}
+	if len(segments) > 4 || (len(segments) < 4 && segments[len(segments)-1] != ">") {
+		return nil, fmt.Errorf("route pattern %q must be domain.model.event_type.status", pattern)
+	}
+	return segments, nil
+}
+
+func matchRoute(pattern, values []string) bool {
+	for i, segment := range pattern {
+		switch segment {
+		case ">":
+			return true
+		case "*":
+		default:
+			if segment != values[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRouterInvalidPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{pattern: "account.user.create.commit", valid: true},
+		{pattern: "account.*.*.commit", valid: true},
+		{pattern: "account.>", valid: true},
+		{pattern: ">", valid: true},
+		{pattern: "account.user", valid: false},
+		{pattern: "account..create.commit", valid: false},
+		{pattern: "account.>.commit", valid: false},
+		{pattern: "account.user.create.commit.extra", valid: false},
+	}
+	handler := func(ctx context.Context, envelope *Envelope) error { return nil }
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			if err := NewRouter().Route(test.pattern, handler); (err == nil) != test.valid {
+				t.Fatalf("route returned %v, expected valid %v", err, test.valid)
+			}
+			panicked := func() (panicked bool) {
+				defer func() { panicked = recover() != nil }()
+				NewRouter().MustRoute(test.pattern, handler)
+				return false
+			}()
+			if panicked == test.valid {
+				t.Fatalf("must route panicked %v, expected valid %v", panicked, test.valid)
+			}
+		})
+	}
+
+	if err := NewRouter().RoutePayload("account.user.create.commit", nil, nil); err == nil {
+		t.Fatal("route with nil payload type is registered")
+	}
+}
+
+func TestRouterHandle(t *testing.T) {
+	var handled []string
+	record := func(name string) Handler {
+		return func(ctx context.Context, envelope *Envelope) error {
+			handled = append(handled, name)
+			return nil
+		}
+	}
+	router := NewRouter().
+		MustRoutePayload("account.user.create.commit", testDeposit{}, func(ctx context.Context, envelope *Envelope, payload interface{}) error {
+			handled = append(handled, "payload")
+			if payload.(*testDeposit).Amount != 10 {
+				return errors.New("payload is not decoded")
+			}
+			return nil
+		}).
+		MustRoute("account.user.*.commit", record("wildcard")).
+		MustRoute("account.>", record("tail")).
+		Default(record("default"))
+
+	tests := []struct {
+		envelope Envelope
+		expected string
+	}{
+		{envelope: Envelope{Domain: "account", Model: "user", EventType: "create", Status: StatusCommit, Data: json.RawMessage(`{"amount":10}`)}, expected: "payload"},
+		{envelope: Envelope{Domain: "account", Model: "user", EventType: "delete", Status: StatusCommit}, expected: "wildcard"},
+		{envelope: Envelope{Domain: "account", Model: "user", EventType: "delete", Status: StatusBegin}, expected: "tail"},
+		{envelope: Envelope{Domain: "bank", Model: "user", EventType: "delete", Status: StatusCommit}, expected: "default"},
+	}
+	for _, test := range tests {
+		handled = nil
+		if err := router.Handle(context.Background(), &test.envelope); err != nil {
+			t.Fatal(err)
+		}
+		if len(handled) != 1 || handled[0] != test.expected {
+			t.Fatalf("%s.%s.%s.%s is handled by %v, expected %s", test.envelope.Domain, test.envelope.Model, test.envelope.EventType, test.envelope.Status, handled, test.expected)
+		}
+	}
+
+	var invalid *invalidMessageError
+	err := router.Handle(context.Background(), &Envelope{Domain: "account", Model: "user", EventType: "create", Status: StatusCommit, Data: json.RawMessage(`{"amount":"ten"}`)})
+	if !errors.As(err, &invalid) {
+		t.Fatalf("undecodable payload returned %v, expected invalid message", err)
+	}
+}
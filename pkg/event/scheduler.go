@@ -0,0 +1,223 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/johnjerrico/gokit-starter-pack/pkg/db"
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+)
+
+//ScheduleTable table storing envelopes waiting for delivery
+const ScheduleTable = "event_schedules"
+
+const (
+	defaultScheduleInterval = time.Second
+	defaultScheduleBatch    = 100
+)
+
+//Scheduler persist envelopes with deliver at time in sql table and publish them when they are due.
+//Delivery is at least once: envelope published right before a crash may be published again after restart.
+type Scheduler struct {
+	db       *sqlx.DB
+	broker   Broker
+	logger   log.Logger
+	interval time.Duration
+	batch    int
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+//SchedulerOption sets optional parameter of Scheduler
+type SchedulerOption func(*Scheduler)
+
+//SchedulerInterval sets how often due envelopes are polled, default is 1 second, non-positive interval keeps the default
+func SchedulerInterval(interval time.Duration) SchedulerOption {
+	return func(s *Scheduler) {
+		if interval > 0 {
+			s.interval = interval
+		}
+	}
+}
+
+//SchedulerBatchSize sets maximum envelopes published per poll, default is 100, non-positive size keeps the default
+func SchedulerBatchSize(size int) SchedulerOption {
+	return func(s *Scheduler) {
+		if size > 0 {
+			s.batch = size
+		}
+	}
+}
+
+//NewScheduler create scheduler publishing due envelopes through broker
+func NewScheduler(conn *sqlx.DB, broker Broker, logger log.Logger, opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		db:       conn,
+		broker:   broker,
+		logger:   logger,
+		interval: defaultScheduleInterval,
+		batch:    defaultScheduleBatch,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+//EnsureTable create schedule table when it does not exist, large tables should add an index on deliver_at
+func (s *Scheduler) EnsureTable() error {
+	_, err := s.db.Exec("CREATE TABLE IF NOT EXISTS " + ScheduleTable + ` (
+		id VARCHAR(64) NOT NULL PRIMARY KEY,
+		subject VARCHAR(255) NOT NULL,
+		envelope TEXT NOT NULL,
+		deliver_at BIGINT NOT NULL,
+		created_at BIGINT NOT NULL
+	)`)
+	return err
+}
+
+//Schedule store envelope to be published into subject at deliver at time, returns schedule id used for cancellation.
+//Transaction in context (db.NewContext) is joined, so envelope is scheduled only when it commits.
+func (s *Scheduler) Schedule(ctx context.Context, subject string, envelope *Envelope, deliverAt time.Time) (string, error) {
+	if envelope.RequestID == "" && envelope.CorrelationID == "" && envelope.TraceID == "" {
+		envelope.Inject(ctx)
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return "", err
+	}
+	id := uuid.New().String()
+	_, err = s.queryable(ctx).NamedExecContext(ctx,
+		"INSERT INTO "+ScheduleTable+" (id, subject, envelope, deliver_at, created_at) VALUES (:id, :subject, :envelope, :deliver_at, :created_at)",
+		map[string]interface{}{
+			"id":         id,
+			"subject":    subject,
+			"envelope":   string(data),
+			"deliver_at": deliverAt.UnixNano(),
+			"created_at": time.Now().UnixNano(),
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+//Cancel remove scheduled envelope, it fails with NOTFOUND error when envelope is unknown or already published
+func (s *Scheduler) Cancel(ctx context.Context, id string) error {
+	res, err := s.queryable(ctx).NamedExecContext(ctx, "DELETE FROM "+ScheduleTable+" WHERE id = :id", map[string]interface{}{"id": id})
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return rError.New(fmt.Errorf("schedule %s not found", id), rError.Enum.NOTFOUND, "schedule_not_found")
+	}
+	return nil
+}
+
+//Start create schedule table if needed and publish due envelopes until Stop is called
+func (s *Scheduler) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return nil
+	}
+	if err := s.EnsureTable(); err != nil {
+		return err
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.run(s.stop, s.done)
+	return nil
+}
+
+//Stop stop publishing and wait for the running poll to finish
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop, s.done = nil, nil
+}
+
+func (s *Scheduler) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		//keep publishing while full batches are due
+		for published := s.batch; published >= s.batch; {
+			var err error
+			if published, err = s.Deliver(context.Background(), time.Now()); err != nil {
+				s.logger.Log("scheduler", "Error when publishing scheduled events", "err", err)
+				break
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//Deliver publish envelopes due at now, returns number of published envelopes.
+//Each envelope is removed and published within one transaction, so concurrent schedulers never publish the same row twice.
+func (s *Scheduler) Deliver(ctx context.Context, now time.Time) (int, error) {
+	var due []struct {
+		ID       string `db:"id"`
+		Subject  string `db:"subject"`
+		Envelope string `db:"envelope"`
+	}
+	if err := s.db.SelectContext(ctx, &due, s.db.Rebind("SELECT id, subject, envelope FROM "+ScheduleTable+" WHERE deliver_at <= ? ORDER BY deliver_at LIMIT ?"), now.UnixNano(), s.batch); err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, row := range due {
+		sent := false
+		err := db.RunInNewTransaction(ctx, s.db, func(ctx context.Context, tx *sqlx.Tx) error {
+			res, err := tx.Exec(tx.Rebind("DELETE FROM "+ScheduleTable+" WHERE id = ?"), row.ID)
+			if err != nil {
+				return err
+			}
+			if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+				return err
+			}
+			if err = s.broker.Publish(row.Subject, []byte(row.Envelope)); err != nil {
+				return err
+			}
+			sent = true
+			return nil
+		})
+		if err != nil {
+			return published, err
+		}
+		if sent {
+			published++
+		}
+	}
+	return published, nil
+}
+
+func (s *Scheduler) queryable(ctx context.Context) db.Queryable {
+	if q, ok := db.QueryableFromContext(ctx); ok {
+		return q
+	}
+	return s.db
+}
@@ -0,0 +1,180 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/johnjerrico/gokit-starter-pack/pkg/db"
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+)
+
+//failingBroker fails publishing into subject fail
+type failingBroker struct {
+	*MemoryBroker
+}
+
+func (b failingBroker) Publish(subject string, data []byte) error {
+	if subject == "fail" {
+		return errors.New("broker is down")
+	}
+	return b.MemoryBroker.Publish(subject, data)
+}
+
+func newScheduler(t *testing.T, broker Broker, opts ...SchedulerOption) *Scheduler {
+	t.Helper()
+	scheduler := NewScheduler(openDB(t), broker, log.NewNopLogger(), opts...)
+	if err := scheduler.EnsureTable(); err != nil {
+		t.Fatal(err)
+	}
+	return scheduler
+}
+
+func schedule(t *testing.T, scheduler *Scheduler, subject string, eventType string, deliverAt time.Time) string {
+	t.Helper()
+	id, err := scheduler.Schedule(context.Background(), subject, &Envelope{Status: StatusCommit, EventType: eventType}, deliverAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func scheduled(t *testing.T, scheduler *Scheduler) int {
+	t.Helper()
+	var count int
+	if err := scheduler.db.Get(&count, "SELECT COUNT(*) FROM "+ScheduleTable); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestSchedulerDeliver(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	scheduler := newScheduler(t, broker)
+	now := time.Now()
+	schedule(t, scheduler, "account", "first", now.Add(-2*time.Minute))
+	schedule(t, scheduler, "account", "second", now.Add(-time.Minute))
+	schedule(t, scheduler, "account", "later", now.Add(time.Hour))
+
+	if n, err := scheduler.Deliver(context.Background(), now); err != nil || n != 2 {
+		t.Fatalf("delivered %d envelopes, err %v", n, err)
+	}
+	var eventTypes []string
+	for _, msg := range broker.Messages("account") {
+		envelope, err := UnmarshalEnvelope(msg.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		eventTypes = append(eventTypes, envelope.EventType)
+	}
+	if fmt.Sprint(eventTypes) != "[first second]" {
+		t.Fatalf("published %v, expected due envelopes by deliver at", eventTypes)
+	}
+	if count := scheduled(t, scheduler); count != 1 {
+		t.Fatalf("%d envelopes are left scheduled, published envelopes must be removed", count)
+	}
+
+	if n, err := scheduler.Deliver(context.Background(), now); err != nil || n != 0 {
+		t.Fatalf("published envelopes are delivered again, delivered %d, err %v", n, err)
+	}
+	if n, err := scheduler.Deliver(context.Background(), now.Add(2*time.Hour)); err != nil || n != 1 {
+		t.Fatalf("delivered %d later envelopes, err %v", n, err)
+	}
+}
+
+func TestSchedulerDeliverFailure(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	scheduler := newScheduler(t, failingBroker{broker})
+	schedule(t, scheduler, "fail", "create", time.Now().Add(-time.Minute))
+
+	if n, err := scheduler.Deliver(context.Background(), time.Now()); err == nil || n != 0 {
+		t.Fatalf("failed publish returned %d, err %v", n, err)
+	}
+	if count := scheduled(t, scheduler); count != 1 {
+		t.Fatal("envelope failed to publish is removed")
+	}
+}
+
+func TestSchedulerBatchSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		expected int
+	}{
+		{name: "batch", size: 2, expected: 2},
+		{name: "zero keeps default", size: 0, expected: 5},
+		{name: "negative keeps default", size: -1, expected: 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker := NewMemoryBroker()
+			defer broker.Close()
+			scheduler := newScheduler(t, broker, SchedulerBatchSize(test.size))
+			for i := 0; i < 5; i++ {
+				schedule(t, scheduler, "account", "create", time.Now().Add(-time.Minute))
+			}
+			if n, err := scheduler.Deliver(context.Background(), time.Now()); err != nil || n != test.expected {
+				t.Fatalf("delivered %d envelopes, expected %d, err %v", n, test.expected, err)
+			}
+		})
+	}
+}
+
+func TestSchedulerStartPublishesFullBatches(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	scheduler := newScheduler(t, broker, SchedulerBatchSize(2), SchedulerInterval(time.Hour))
+	for i := 0; i < 5; i++ {
+		schedule(t, scheduler, "account", "create", time.Now().Add(-time.Minute))
+	}
+
+	//first poll keeps publishing while batches are full, remaining envelopes wait for the next tick
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer scheduler.Stop()
+	eventually(t, func() bool { return len(broker.Messages("account")) == 5 })
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	scheduler := newScheduler(t, broker)
+	id := schedule(t, scheduler, "account", "create", time.Now().Add(-time.Minute))
+
+	if err := scheduler.Cancel(context.Background(), id); err != nil {
+		t.Fatal(err)
+	}
+	err := scheduler.Cancel(context.Background(), id)
+	if rerr, ok := err.(*rError.Error); !ok || rerr.Kind() != rError.Enum.NOTFOUND {
+		t.Fatalf("cancelling cancelled envelope returned %v", err)
+	}
+	if n, err := scheduler.Deliver(context.Background(), time.Now()); err != nil || n != 0 {
+		t.Fatalf("cancelled envelope is delivered, delivered %d, err %v", n, err)
+	}
+}
+
+func TestSchedulerJoinsTransaction(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	scheduler := newScheduler(t, broker)
+
+	rollback := errors.New("rollback")
+	err := db.RunInTransactionContext(context.Background(), scheduler.db, func(ctx context.Context) error {
+		if _, err := scheduler.Schedule(ctx, "account", &Envelope{Status: StatusCommit}, time.Now()); err != nil {
+			return err
+		}
+		return rollback
+	})
+	if err != rollback {
+		t.Fatalf("rolled back transaction returned %v", err)
+	}
+	if count := scheduled(t, scheduler); count != 0 {
+		t.Fatal("envelope of rolled back transaction is scheduled")
+	}
+}
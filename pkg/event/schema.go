@@ -0,0 +1,159 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+//ValidationMode what publisher does with envelope failing its schema
+type ValidationMode int
+
+const (
+	//ValidationReject reject invalid envelope with UNPROCESSABLEENTITY error, it is not published
+	ValidationReject ValidationMode = iota
+	//ValidationLog log invalid envelope and publish it anyway
+	ValidationLog
+)
+
+//Schemas registry of json schemas validating envelope payload by domain, model, event type, status and schema version
+type Schemas struct {
+	mu      sync.RWMutex
+	schemas map[string]*jsonschema.Schema
+	sources map[string]json.RawMessage
+}
+
+//NewSchemas create empty schema registry
+func NewSchemas() *Schemas {
+	return &Schemas{
+		schemas: make(map[string]*jsonschema.Schema),
+		sources: make(map[string]json.RawMessage),
+	}
+}
+
+//Register compile json schema of event payload at schema version.
+//Schema validates envelopes of statuses, default is commit since begin carries the request instead of the event.
+func (s *Schemas) Register(domain, model, eventType string, version int, schema string, statuses ...string) error {
+	if len(statuses) == 0 {
+		statuses = []string{StatusCommit}
+	}
+	compiled, err := jsonschema.CompileString(fmt.Sprintf("event:///%s/%s/%s/v%d.json", domain, model, eventType, version), schema)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, status := range statuses {
+		key := schemaKey(domain, model, eventType, status, version)
+		s.schemas[key] = compiled
+		s.sources[key] = json.RawMessage(schema)
+	}
+	return nil
+}
+
+//Source return registered json schema of event payload at schema version
+func (s *Schemas) Source(domain, model, eventType, status string, version int) (json.RawMessage, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	source, ok := s.sources[schemaKey(domain, model, eventType, status, version)]
+	return source, ok
+}
+
+//Validate validate envelope payload against schema of its version, envelope without schema is valid.
+//It fails with UNPROCESSABLEENTITY error describing every violation.
+func (s *Schemas) Validate(envelope *Envelope) error {
+	s.mu.RLock()
+	schema, ok := s.schemas[schemaKey(envelope.Domain, envelope.Model, envelope.EventType, envelope.Status, envelope.Version())]
+	s.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	payload, err := validationTree(envelope)
+	if err != nil {
+		return rError.New(err, rError.Enum.UNPROCESSABLEENTITY, "invalid_event_payload")
+	}
+	if err = schema.Validate(payload); err != nil {
+		var details []string
+		if verr, ok := err.(*jsonschema.ValidationError); ok {
+			for _, cause := range leafCauses(verr) {
+				details = append(details, fmt.Sprintf("%s: %s", cause.InstanceLocation, cause.Message))
+			}
+		}
+		if len(details) == 0 {
+			details = append(details, err.Error())
+		}
+		return rError.New(
+			fmt.Errorf("%s.%s.%s v%d is invalid: %s", envelope.Domain, envelope.Model, envelope.EventType, envelope.Version(), strings.Join(details, "; ")),
+			rError.Enum.UNPROCESSABLEENTITY,
+			"invalid_event_payload",
+		)
+	}
+	return nil
+}
+
+//rejectedError envelope rejected by ValidationReject or maximum payload size, publisher returns the cause from endpoint
+type rejectedError struct {
+	err error
+}
+
+func (e *rejectedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *rejectedError) Unwrap() error {
+	return e.err
+}
+
+//rejectionCause return cause of rejected envelope, other errors are returned as is
+func rejectionCause(err error) error {
+	if rejected, ok := err.(*rejectedError); ok {
+		return rejected.err
+	}
+	return err
+}
+
+func schemaKey(domain, model, eventType, status string, version int) string {
+	return fmt.Sprintf("%s/%s/%s/%s/%d", domain, model, eventType, status, version)
+}
+
+//validationTree decode payload of any codec into generic json value
+func validationTree(envelope *Envelope) (interface{}, error) {
+	var data []byte
+	if envelope.ContentType == "" && envelope.ContentEncoding == "" {
+		data = envelope.Data
+	} else {
+		var v interface{}
+		if err := envelope.Decode(&v); err != nil {
+			return nil, err
+		}
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var tree interface{}
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+func leafCauses(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+	var causes []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		causes = append(causes, leafCauses(cause)...)
+	}
+	return causes
+}
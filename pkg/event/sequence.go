@@ -0,0 +1,301 @@
+package event
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/jmoiron/sqlx"
+	"github.com/johnjerrico/gokit-starter-pack/pkg/db"
+)
+
+//SequenceTable table storing last sequence number of each key
+const SequenceTable = "event_sequences"
+
+//Sequencer allocate increasing sequence numbers per key, starting from 1
+type Sequencer interface {
+	Next(ctx context.Context, key string) (uint64, error)
+}
+
+//PublisherSequence number commit envelopes per key extracted by key, ex: PartitionByField("id").
+//Envelope with empty key is not numbered. Sequence is allocated after envelope is validated and encoded, so rejected envelope
+//does not consume it. When sequencer fails envelope is published without sequence and the error is logged.
+func PublisherSequence(sequencer Sequencer, key PartitionKey) PublisherOption {
+	return func(p *Publisher) {
+		p.sequencer = sequencer
+		p.sequenceKey = key
+	}
+}
+
+//reserveSequence stamp commit envelope with its sequence key and the widest sequence, so size of encoded envelope
+//is checked before sequence is allocated. It returns false when envelope is not numbered.
+func (p *Publisher) reserveSequence(envelope *Envelope) bool {
+	if envelope.Status != StatusCommit {
+		return false
+	}
+	key := p.sequenceKey(envelope)
+	if key == "" {
+		return false
+	}
+	envelope.SequenceKey = key
+	envelope.Sequence = math.MaxUint64
+	return true
+}
+
+//sequence stamp envelope reserved by reserveSequence with next sequence of its key
+func (p *Publisher) sequence(ctx context.Context, envelope *Envelope) {
+	sequence, err := p.sequencer.Next(ctx, envelope.SequenceKey)
+	if err != nil {
+		p.logger.Log("error_sequence_event", err, "key", envelope.SequenceKey)
+		envelope.SequenceKey = ""
+		envelope.Sequence = 0
+		return
+	}
+	envelope.Sequence = sequence
+}
+
+type memorySequencer struct {
+	mu        sync.Mutex
+	sequences map[string]uint64
+}
+
+//NewMemorySequencer create sequencer keeping counters in memory, counters are lost on restart so it fits single instance tests only
+func NewMemorySequencer() Sequencer {
+	return &memorySequencer{sequences: make(map[string]uint64)}
+}
+
+func (s *memorySequencer) Next(ctx context.Context, key string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sequences[key]++
+	return s.sequences[key], nil
+}
+
+//SQLSequencer sequencer keeping counters in sql table, shared by every instance of publisher
+type SQLSequencer struct {
+	db *sqlx.DB
+}
+
+//NewSQLSequencer create sequencer keeping counters in SequenceTable
+func NewSQLSequencer(conn *sqlx.DB) *SQLSequencer {
+	return &SQLSequencer{db: conn}
+}
+
+//EnsureTable create sequence table when it does not exist
+func (s *SQLSequencer) EnsureTable() error {
+	_, err := s.db.Exec("CREATE TABLE IF NOT EXISTS " + SequenceTable + ` (
+		sequence_key VARCHAR(255) NOT NULL PRIMARY KEY,
+		sequence BIGINT NOT NULL
+	)`)
+	return err
+}
+
+//Next increment counter of key. Context holding transaction (see db.NewContext) increments it within that transaction,
+//so sequence is allocated only when the transaction commits, otherwise within its own transaction and
+//concurrent first use of a key is retried once.
+func (s *SQLSequencer) Next(ctx context.Context, key string) (uint64, error) {
+	if q, ok := db.QueryableFromContext(ctx); ok {
+		if ext, ok := q.(sqlx.ExtContext); ok {
+			return s.next(ctx, ext, key)
+		}
+	}
+	sequence, err := s.nextInTransaction(ctx, key)
+	if err != nil {
+		sequence, err = s.nextInTransaction(ctx, key)
+	}
+	return sequence, err
+}
+
+func (s *SQLSequencer) nextInTransaction(ctx context.Context, key string) (sequence uint64, err error) {
+	err = db.RunInNewTransaction(ctx, s.db, func(ctx context.Context, tx *sqlx.Tx) error {
+		sequence, err = s.next(ctx, tx, key)
+		return err
+	})
+	return sequence, err
+}
+
+func (s *SQLSequencer) next(ctx context.Context, q sqlx.ExtContext, key string) (uint64, error) {
+	var sequence int64
+	res, err := q.ExecContext(ctx, q.Rebind("UPDATE "+SequenceTable+" SET sequence = sequence + 1 WHERE sequence_key = ?"), key)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		sequence = 1
+		_, err = q.ExecContext(ctx, q.Rebind("INSERT INTO "+SequenceTable+" (sequence_key, sequence) VALUES (?, ?)"), key, sequence)
+		return uint64(sequence), err
+	}
+	if err = sqlx.GetContext(ctx, q, &sequence, q.Rebind("SELECT sequence FROM "+SequenceTable+" WHERE sequence_key = ?"), key); err != nil {
+		return 0, err
+	}
+	return uint64(sequence), nil
+}
+
+//SequenceAnomaly kind of unexpected sequence received by SequenceChecker
+type SequenceAnomaly int
+
+const (
+	//SequenceGap envelopes between the last handled and the received sequence were not received
+	SequenceGap SequenceAnomaly = iota
+	//SequenceOutOfOrder envelope is older than the last handled envelope of its key
+	SequenceOutOfOrder
+	//SequenceDuplicate envelope of the last handled sequence is received again
+	SequenceDuplicate
+)
+
+func (a SequenceAnomaly) String() string {
+	switch a {
+	case SequenceGap:
+		return "gap"
+	case SequenceOutOfOrder:
+		return "out_of_order"
+	default:
+		return "duplicate"
+	}
+}
+
+//SequenceReport unexpected sequence received for key, Expected is the sequence following the last handled one
+type SequenceReport struct {
+	Anomaly  SequenceAnomaly
+	Key      string
+	Expected uint64
+	Received uint64
+	Envelope *Envelope
+}
+
+//Missing number of envelopes skipped by gap
+func (r SequenceReport) Missing() uint64 {
+	if r.Anomaly != SequenceGap {
+		return 0
+	}
+	return r.Received - r.Expected
+}
+
+//SequenceMetrics go-kit metrics of sequence anomalies, every metric is labelled with domain and model.
+//Nil metric is not recorded.
+type SequenceMetrics struct {
+	Gaps       metrics.Counter //gaps detected
+	Missing    metrics.Counter //envelopes skipped by gaps
+	OutOfOrder metrics.Counter //envelopes older than the last handled one
+	Duplicates metrics.Counter //envelopes of the last handled sequence received again
+}
+
+func (m SequenceMetrics) withDefaults() SequenceMetrics {
+	if m.Gaps == nil {
+		m.Gaps = discard.NewCounter()
+	}
+	if m.Missing == nil {
+		m.Missing = discard.NewCounter()
+	}
+	if m.OutOfOrder == nil {
+		m.OutOfOrder = discard.NewCounter()
+	}
+	if m.Duplicates == nil {
+		m.Duplicates = discard.NewCounter()
+	}
+	return m
+}
+
+//SequenceChecker detect gaps, out of order and duplicate envelopes per sequence key.
+//Last handled sequence of each key is kept in memory, the first envelope of a key seen by checker is its baseline.
+type SequenceChecker struct {
+	metrics  SequenceMetrics
+	callback func(ctx context.Context, report SequenceReport)
+
+	mu   sync.Mutex
+	last map[string]uint64
+}
+
+//SequenceCheckerOption sets optional parameter of SequenceChecker
+type SequenceCheckerOption func(*SequenceChecker)
+
+//SequenceCheckerMetrics record anomalies into metrics
+func SequenceCheckerMetrics(m SequenceMetrics) SequenceCheckerOption {
+	return func(c *SequenceChecker) { c.metrics = m.withDefaults() }
+}
+
+//SequenceCheckerCallback call callback on every anomaly before envelope is handled, ex: to resync state of the key on gap
+func SequenceCheckerCallback(callback func(ctx context.Context, report SequenceReport)) SequenceCheckerOption {
+	return func(c *SequenceChecker) { c.callback = callback }
+}
+
+//NewSequenceChecker create checker without known sequences
+func NewSequenceChecker(opts ...SequenceCheckerOption) *SequenceChecker {
+	c := &SequenceChecker{
+		metrics: SequenceMetrics{}.withDefaults(),
+		last:    make(map[string]uint64),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+//HandlerSequenceChecker check sequence of envelopes before they are handled, envelope is handled whatever its sequence is.
+//Sequence is recorded as handled only when handler succeeds, so redelivery of failed envelope is not reported.
+func HandlerSequenceChecker(checker *SequenceChecker) HandlerOption {
+	return func(h *envelopeHandler) { h.sequences = checker }
+}
+
+//Last return last handled sequence of key, zero when key is unknown
+func (c *SequenceChecker) Last(key string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last[key]
+}
+
+//Reset forget last handled sequence of key, ex: after its state was resynced
+func (c *SequenceChecker) Reset(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.last, key)
+}
+
+//check report anomaly of envelope sequence
+func (c *SequenceChecker) check(ctx context.Context, envelope *Envelope) {
+	if envelope.SequenceKey == "" || envelope.Sequence == 0 {
+		return
+	}
+	c.mu.Lock()
+	last, ok := c.last[envelope.SequenceKey]
+	c.mu.Unlock()
+	if !ok || envelope.Sequence == last+1 {
+		return
+	}
+
+	report := SequenceReport{Key: envelope.SequenceKey, Expected: last + 1, Received: envelope.Sequence, Envelope: envelope}
+	labels := []string{"domain", envelope.Domain, "model", envelope.Model}
+	switch {
+	case envelope.Sequence > last+1:
+		report.Anomaly = SequenceGap
+		c.metrics.Gaps.With(labels...).Add(1)
+		c.metrics.Missing.With(labels...).Add(float64(report.Missing()))
+	case envelope.Sequence == last:
+		report.Anomaly = SequenceDuplicate
+		c.metrics.Duplicates.With(labels...).Add(1)
+	default:
+		report.Anomaly = SequenceOutOfOrder
+		c.metrics.OutOfOrder.With(labels...).Add(1)
+	}
+	if c.callback != nil {
+		c.callback(ctx, report)
+	}
+}
+
+//handled record envelope sequence as handled, older sequence does not move last sequence back
+func (c *SequenceChecker) handled(envelope *Envelope) {
+	if envelope.SequenceKey == "" || envelope.Sequence == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if envelope.Sequence > c.last[envelope.SequenceKey] {
+		c.last[envelope.SequenceKey] = envelope.Sequence
+	}
+}
@@ -0,0 +1,169 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/johnjerrico/gokit-starter-pack/pkg/db"
+)
+
+//testCounter sum values added with any labels
+type testCounter struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (c *testCounter) With(labelValues ...string) metrics.Counter { return c }
+
+func (c *testCounter) Add(delta float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value += delta
+}
+
+func (c *testCounter) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+func TestSequenceChecker(t *testing.T) {
+	var reports []string
+	m := SequenceMetrics{Gaps: &testCounter{}, Missing: &testCounter{}, OutOfOrder: &testCounter{}, Duplicates: &testCounter{}}
+	checker := NewSequenceChecker(SequenceCheckerMetrics(m), SequenceCheckerCallback(func(ctx context.Context, report SequenceReport) {
+		reports = append(reports, fmt.Sprintf("%s %s expected %d received %d missing %d", report.Anomaly, report.Key, report.Expected, report.Received, report.Missing()))
+	}))
+	fail := errors.New("handler failed")
+	handler := Handle(func(ctx context.Context, envelope *Envelope) error {
+		if envelope.EventType == "fail" {
+			return fail
+		}
+		return nil
+	}, HandlerSequenceChecker(checker))
+
+	tests := []struct {
+		key       string
+		sequence  uint64
+		eventType string
+		report    string
+		last      uint64
+	}{
+		{key: "a1", sequence: 3, last: 3},
+		{key: "a1", sequence: 4, last: 4},
+		{key: "a1", sequence: 7, report: "gap a1 expected 5 received 7 missing 2", last: 7},
+		{key: "a1", sequence: 7, report: "duplicate a1 expected 8 received 7 missing 0", last: 7},
+		{key: "a1", sequence: 5, report: "out_of_order a1 expected 8 received 5 missing 0", last: 7},
+		{key: "a2", sequence: 1, last: 1},
+		{key: "a2", sequence: 2, eventType: "fail", last: 1},
+		{key: "a2", sequence: 2, last: 2},
+		{key: "", sequence: 0},
+	}
+	for i, test := range tests {
+		reports = nil
+		eventType := test.eventType
+		if eventType == "" {
+			eventType = "deposit"
+		}
+		envelope := &Envelope{Status: StatusCommit, EventType: eventType, SequenceKey: test.key, Sequence: test.sequence, Data: []byte("{}")}
+		deliver(t, handler, envelope)
+		if fmt.Sprint(reports) != fmt.Sprint(reportList(test.report)) {
+			t.Fatalf("envelope %d reported %v, expected %q", i, reports, test.report)
+		}
+		if test.key != "" && checker.Last(test.key) != test.last {
+			t.Fatalf("envelope %d last sequence %d, expected %d", i, checker.Last(test.key), test.last)
+		}
+	}
+	for _, recorded := range []struct {
+		name     string
+		counter  metrics.Counter
+		expected float64
+	}{
+		{name: "gaps", counter: m.Gaps, expected: 1},
+		{name: "missing", counter: m.Missing, expected: 2},
+		{name: "out of order", counter: m.OutOfOrder, expected: 1},
+		{name: "duplicates", counter: m.Duplicates, expected: 1},
+	} {
+		if value := recorded.counter.(*testCounter).Value(); value != recorded.expected {
+			t.Fatalf("%s recorded %v, expected %v", recorded.name, value, recorded.expected)
+		}
+	}
+
+	checker.Reset("a1")
+	reports = nil
+	deliver(t, handler, &Envelope{Status: StatusCommit, EventType: "deposit", SequenceKey: "a1", Sequence: 20, Data: []byte("{}")})
+	if len(reports) != 0 || checker.Last("a1") != 20 {
+		t.Fatalf("reset key reported %v, last %d", reports, checker.Last("a1"))
+	}
+}
+
+func deliver(t *testing.T, handler MsgHandler, envelope *Envelope) {
+	t.Helper()
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler(NewMsg("account", 1, data, func() error { return nil }))
+}
+
+func reportList(report string) []string {
+	if report == "" {
+		return nil
+	}
+	return []string{report}
+}
+
+func TestPublisherSequence(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	sequencer := NewSQLSequencer(openDB(t))
+	if err := sequencer.EnsureTable(); err != nil {
+		t.Fatal(err)
+	}
+	publisher := NewBrokerPublisher(broker, log.NewNopLogger(), PublisherSequence(sequencer, PartitionByField("id")))
+	endpoint := publisher.Store("bank", "account", "deposit", "account", "test", func(ctx context.Context, request interface{}) (interface{}, error) {
+		return request, nil
+	}, func(data interface{}) interface{} { return data })
+
+	for _, id := range []string{"a1", "a2", "a1", ""} {
+		if _, err := endpoint(context.Background(), map[string]string{"id": id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//sequence allocated within rolled back transaction is not consumed
+	rollback := errors.New("rollback")
+	err := db.RunInTransactionContext(context.Background(), sequencer.db, func(ctx context.Context) error {
+		if _, err := sequencer.Next(ctx, "a1"); err != nil {
+			return err
+		}
+		return rollback
+	})
+	if err != rollback {
+		t.Fatalf("rolled back transaction returned %v", err)
+	}
+	if _, err = endpoint(context.Background(), map[string]string{"id": "a1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var numbered []string
+	for _, msg := range broker.Messages("account") {
+		envelope, err := UnmarshalEnvelope(msg.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if envelope.Status != StatusCommit && (envelope.SequenceKey != "" || envelope.Sequence != 0) {
+			t.Fatalf("%s envelope is numbered", envelope.Status)
+		}
+		if envelope.Status == StatusCommit {
+			numbered = append(numbered, fmt.Sprintf("%s:%d", envelope.SequenceKey, envelope.Sequence))
+		}
+	}
+	if fmt.Sprint(numbered) != "[a1:1 a2:1 a1:2 :0 a1:3]" {
+		t.Fatalf("commit envelopes are numbered %v", numbered)
+	}
+}
@@ -0,0 +1,44 @@
+package event
+
+import (
+	"strconv"
+	"strings"
+)
+
+//Routes subject template of each envelope status, empty subject suppresses envelope of the status
+type Routes map[string]string
+
+//StoreOption sets optional parameter of a single Store endpoint, its routing takes precedence over publisher routes
+type StoreOption func(*storeOptions)
+
+type storeOptions struct {
+	routes   Routes
+	request  interface{}
+	response interface{}
+}
+
+//StoreRoute publish envelope of status into subject template
+func StoreRoute(status, subject string) StoreOption {
+	return func(o *storeOptions) { o.routes[status] = subject }
+}
+
+//StoreWithoutBegin does not publish begin envelope of the endpoint, commit and error envelopes are still published
+func StoreWithoutBegin() StoreOption {
+	return StoreRoute(StatusBegin, "")
+}
+
+//RenderSubject replace {domain}, {model}, {event_type}, {status}, {event_source} and {schema_version}
+//placeholders of template with envelope fields, ex: {domain}.{model}.{event_type}.{status}
+func RenderSubject(template string, envelope *Envelope) string {
+	if !strings.Contains(template, "{") {
+		return template
+	}
+	return strings.NewReplacer(
+		"{domain}", envelope.Domain,
+		"{model}", envelope.Model,
+		"{event_type}", envelope.EventType,
+		"{status}", envelope.Status,
+		"{event_source}", envelope.EventSource,
+		"{schema_version}", strconv.Itoa(envelope.Version()),
+	).Replace(template)
+}
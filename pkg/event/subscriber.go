@@ -2,29 +2,64 @@ package event
 
 import (
 	"fmt"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/nats-io/nats.go/jetstream"
 	stan "github.com/nats-io/stan.go"
 )
 
 // Subscriber wraps subscription to topic a URL and provides a method that implements endpoint.Endpoint.
 type Subscriber struct {
-	conn       stan.Conn
-	subject    string
-	queueGroup string
-	durable    string
-	startAt    string //avaliable ops : all, seqno, time, since (for more information: https://golang.org/pkg/time/#ParseDuration)
-	handler    stan.MsgHandler
-	logger     log.Logger
+	conn        Broker
+	subject     string
+	queueGroup  string
+	durable     string
+	startAt     string //avaliable ops : all, seqno, time, since (for more information: https://golang.org/pkg/time/#ParseDuration)
+	handler     MsgHandler
+	logger      log.Logger
+	manualAck   bool
+	ackWait     time.Duration
+	maxInflight int
+	metrics     *SubscriberMetrics
+
+	workers      int
+	partitionKey PartitionKey
+
+	catalog        *Catalog
+	catalogEntries []CatalogEntry
+}
+
+//SubscriberOption sets optional parameter of Subscriber
+type SubscriberOption func(*Subscriber)
+
+//SubscriberManualAck subscribe in manual ack mode, unacknowledged message is redelivered after ackWait
+func SubscriberManualAck(ackWait time.Duration) SubscriberOption {
+	return func(s *Subscriber) {
+		s.manualAck = true
+		s.ackWait = ackWait
+	}
+}
+
+//SubscriberMaxInflight sets maximum number of unacknowledged message delivered to subscriber
+func SubscriberMaxInflight(maxInflight int) SubscriberOption {
+	return func(s *Subscriber) { s.maxInflight = maxInflight }
 }
 
 //NewSubscriber to create new Subscriber
-func NewSubscriber(conn stan.Conn, subject string, group string, durable string, startAt string, logger log.Logger, handler stan.MsgHandler) *Subscriber {
-	return &Subscriber{
-		conn:       conn,
+func NewSubscriber(conn stan.Conn, subject string, group string, durable string, startAt string, logger log.Logger, handler stan.MsgHandler, opts ...SubscriberOption) *Subscriber {
+	return NewBrokerSubscriber(NewStanBroker(conn), subject, group, durable, startAt, logger, stanHandler(handler), opts...)
+}
+
+//NewJetStreamSubscriber to create new Subscriber consuming jetstream stream, queue group and durable are mapped into durable consumer
+func NewJetStreamSubscriber(js jetstream.JetStream, stream string, subject string, group string, durable string, startAt string, logger log.Logger, handler MsgHandler, opts ...SubscriberOption) *Subscriber {
+	return NewBrokerSubscriber(NewJetStreamBroker(js, stream), subject, group, durable, startAt, logger, handler, opts...)
+}
+
+//NewBrokerSubscriber to create new Subscriber subscribing through broker
+func NewBrokerSubscriber(broker Broker, subject string, group string, durable string, startAt string, logger log.Logger, handler MsgHandler, opts ...SubscriberOption) *Subscriber {
+	s := &Subscriber{
+		conn:       broker,
 		subject:    subject,
 		logger:     logger,
 		queueGroup: group,
@@ -32,46 +67,65 @@ func NewSubscriber(conn stan.Conn, subject string, group string, durable string,
 		startAt:    startAt,
 		handler:    handler,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.catalog != nil {
+		s.register()
+	}
+	return s
 }
 
 //Subscribe to subscribe topic to nats
-func (s *Subscriber) Subscribe() *stan.Subscription {
-	var startOpt stan.SubscriptionOption
-	if s.startAt == "all" {
-		startOpt = stan.DeliverAllAvailable()
-	} else if s.startAt == "since" {
-		var option = strings.Split(s.startAt, ":")
-		ago, err := time.ParseDuration(option[1])
-		if err != nil {
-			s.logger.Log("nats", fmt.Sprintf("Error when subscribing topic %s", s.subject))
-			s.logger.Log("err", err)
-			return nil
-		}
-		startOpt = stan.StartAtTimeDelta(ago)
-	} else if s.startAt == "time" {
-		var option = strings.Split(s.startAt, ":")
-		intTimestamp, err := strconv.ParseInt(option[1], 10, 64)
-		if err != nil {
-			s.logger.Log("nats", fmt.Sprintf("Error when subscribing topic %s", s.subject))
-			s.logger.Log("err", err)
-			return nil
-		}
-		startOpt = stan.StartAtTime(time.Unix(intTimestamp, 0))
-	} else if s.startAt == "seqno" {
-		var option = strings.Split(s.startAt, ":")
-		intSeq, err := strconv.ParseUint(option[1], 10, 64)
-		if err != nil {
-			s.logger.Log("nats", fmt.Sprintf("Error when subscribing topic %s", s.subject))
-			s.logger.Log("err", err)
-			return nil
+func (s *Subscriber) Subscribe() Subscription {
+	start, err := ParseStartAt(s.startAt)
+	if err != nil {
+		s.logger.Log("nats", fmt.Sprintf("Error when subscribing topic %s", s.subject))
+		s.logger.Log("err", err)
+		return nil
+	}
+	handler := s.handler
+	if s.metrics != nil {
+		handler = s.metrics.instrument(handler)
+	}
+	opts := SubscribeOptions{
+		QueueGroup:  s.queueGroup,
+		Durable:     s.durable,
+		Start:       start,
+		ManualAck:   s.manualAck,
+		AckWait:     s.ackWait,
+		MaxInflight: s.maxInflight,
+	}
+	var pool *workerPool
+	if s.workers > 0 {
+		if opts.MaxInflight <= 0 {
+			opts.MaxInflight = s.workers * defaultWorkerQueue
 		}
-		startOpt = stan.StartAtSequence(intSeq)
+		pool = newWorkerPool(s.workers, opts.MaxInflight, s.partitionKey, s.manualAck, handler)
+		handler = pool.dispatch
+		opts.ManualAck = true
 	}
-	sub, err := s.conn.QueueSubscribe(s.subject, s.queueGroup, s.handler, stan.DurableName(s.durable), startOpt)
+	sub, err := s.conn.Subscribe(s.subject, handler, opts)
 	if err != nil {
+		if pool != nil {
+			pool.stop()
+		}
 		s.logger.Log("nats", fmt.Sprintf("Error when subscribing topic %s", s.subject))
+		s.logger.Log("err", err)
 		return nil
 	}
+	if pool != nil {
+		sub = &workerSubscription{Subscription: sub, pool: pool}
+	}
 	s.logger.Log("nats", fmt.Sprintf("Subscribed topic %s with durable %s and start option %s", s.subject, s.durable, s.startAt))
-	return &sub
+	return sub
+}
+
+//Inject deliver message into subscriber handler synchronously without broker, worker pool is bypassed
+func (s *Subscriber) Inject(msg *Msg) {
+	handler := s.handler
+	if s.metrics != nil {
+		handler = s.metrics.instrument(handler)
+	}
+	handler(msg)
 }
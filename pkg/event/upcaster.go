@@ -0,0 +1,107 @@
+package event
+
+import (
+	"fmt"
+	"sync"
+
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+)
+
+//Upcaster transform uncompressed payload from one schema version into the next version
+type Upcaster func(data []byte) ([]byte, error)
+
+type upcasterKey struct {
+	domain    string
+	model     string
+	eventType string
+}
+
+//Upcasters registry of upcaster chains per domain, model and event type
+type Upcasters struct {
+	mu     sync.RWMutex
+	chains map[upcasterKey]map[int]Upcaster
+	latest map[upcasterKey]int
+}
+
+//NewUpcasters create empty upcaster registry
+func NewUpcasters() *Upcasters {
+	return &Upcasters{
+		chains: make(map[upcasterKey]map[int]Upcaster),
+		latest: make(map[upcasterKey]int),
+	}
+}
+
+//Register upcaster transforming payload of version `from` into version `from+1`
+func (u *Upcasters) Register(domain, model, eventType string, from int, f Upcaster) *Upcasters {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	key := upcasterKey{domain, model, eventType}
+	if u.chains[key] == nil {
+		u.chains[key] = make(map[int]Upcaster)
+	}
+	u.chains[key][from] = f
+	if from+1 > u.latest[key] {
+		u.latest[key] = from + 1
+	}
+	return u
+}
+
+//Current return current schema version of domain, model and event type, 1 if no upcaster registered
+func (u *Upcasters) Current(domain, model, eventType string) int {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	if v, ok := u.latest[upcasterKey{domain, model, eventType}]; ok {
+		return v
+	}
+	return 1
+}
+
+//Upcast transform envelope data into current schema version
+func (u *Upcasters) Upcast(envelope *Envelope) error {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	key := upcasterKey{envelope.Domain, envelope.Model, envelope.EventType}
+	current, ok := u.latest[key]
+	if !ok {
+		current = 1
+	}
+
+	version := envelope.Version()
+	if version > current {
+		return rError.New(
+			fmt.Errorf("unknown schema version %d of %s.%s.%s, current version is %d", version, envelope.Domain, envelope.Model, envelope.EventType, current),
+			rError.Enum.UNPROCESSABLEENTITY,
+			"unknown_schema_version",
+		)
+	}
+
+	if version == current {
+		return nil
+	}
+	if err := envelope.Decompress(); err != nil {
+		return err
+	}
+	data, err := envelope.Payload()
+	if err != nil {
+		return err
+	}
+	for ; version < current; version++ {
+		f, ok := u.chains[key][version]
+		if !ok {
+			return rError.New(
+				fmt.Errorf("no upcaster from schema version %d of %s.%s.%s", version, envelope.Domain, envelope.Model, envelope.EventType),
+				rError.Enum.UNPROCESSABLEENTITY,
+				"unknown_schema_version",
+			)
+		}
+		if data, err = f(data); err != nil {
+			return err
+		}
+	}
+
+	envelope.SchemaVersion = current
+	return envelope.SetPayload(data, envelope.ContentType, "")
+}
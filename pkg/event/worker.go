@@ -0,0 +1,152 @@
+package event
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+)
+
+const defaultWorkerQueue = 16
+
+//PartitionKey extract ordering key of envelope, messages with the same key are handled in publish order
+type PartitionKey func(envelope *Envelope) string
+
+//PartitionByAggregate partition messages by aggregate id
+func PartitionByAggregate(envelope *Envelope) string {
+	return envelope.AggregateID
+}
+
+//PartitionByField partition messages by payload field at dot separated path, ex: user.id
+func PartitionByField(path string) PartitionKey {
+	keys := strings.Split(path, ".")
+	return func(envelope *Envelope) string {
+		var node interface{}
+		if err := envelope.Decode(&node); err != nil {
+			return ""
+		}
+		for _, key := range keys {
+			object, ok := node.(map[string]interface{})
+			if !ok {
+				return ""
+			}
+			node = object[key]
+		}
+		if node == nil {
+			return ""
+		}
+		return fmt.Sprint(node)
+	}
+}
+
+//SubscriberWorkers handle messages with n concurrent workers, messages with the same partition key are handled by the same worker in order.
+//Broker subscription is switched into manual ack mode, message is acknowledged after its handler returns without error (see Handle)
+//unless SubscriberManualAck is set, then handler acknowledges it. MaxInflight bounds messages queued in workers. Undecodable message has empty partition key.
+//Redelivered message is handled again in order of redelivery, not original order.
+func SubscriberWorkers(workers int, key PartitionKey) SubscriberOption {
+	return func(s *Subscriber) {
+		s.workers = workers
+		s.partitionKey = key
+	}
+}
+
+//workerPool dispatch messages into workers by partition key, a full worker queue blocks broker delivery
+type workerPool struct {
+	mu        sync.RWMutex
+	handler   MsgHandler
+	key       PartitionKey
+	manualAck bool
+	queues    []chan *Msg
+	wg        sync.WaitGroup
+	stopped   bool
+}
+
+func newWorkerPool(workers, maxInflight int, key PartitionKey, manualAck bool, handler MsgHandler) *workerPool {
+	size := maxInflight / workers
+	if size < 1 {
+		size = 1
+	}
+	p := &workerPool{
+		handler:   handler,
+		key:       key,
+		manualAck: manualAck,
+		queues:    make([]chan *Msg, workers),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan *Msg, size)
+		p.wg.Add(1)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+//dispatch is the broker message handler of the pool
+func (p *workerPool) dispatch(msg *Msg) {
+	queue := p.queues[p.partition(msg)]
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.stopped {
+		return
+	}
+	queue <- msg
+}
+
+func (p *workerPool) partition(msg *Msg) int {
+	var key string
+	if p.key != nil {
+		if envelope, err := UnmarshalEnvelope(msg.Data); err == nil {
+			key = p.key(envelope)
+		}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+func (p *workerPool) work(queue <-chan *Msg) {
+	defer p.wg.Done()
+	for msg := range queue {
+		if p.manualAck {
+			p.handler(msg)
+			continue
+		}
+		ack := msg.ack
+		msg.ack = nil
+		p.handler(msg)
+		if msg.err == nil && ack != nil {
+			ack()
+		}
+	}
+}
+
+//stop stop accepting messages and wait until queued messages are handled
+func (p *workerPool) stop() {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return
+	}
+	p.stopped = true
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+type workerSubscription struct {
+	Subscription
+	pool *workerPool
+}
+
+func (s *workerSubscription) Unsubscribe() error {
+	err := s.Subscription.Unsubscribe()
+	s.pool.stop()
+	return err
+}
+
+func (s *workerSubscription) Close() error {
+	err := s.Subscription.Close()
+	s.pool.stop()
+	return err
+}
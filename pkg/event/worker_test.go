@@ -0,0 +1,171 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func aggregateMsg(t *testing.T, subject string, sequence uint64, aggregateID string, version int, ack func() error) *Msg {
+	t.Helper()
+	data, err := json.Marshal(&Envelope{Domain: "bank", Model: "account", Status: StatusCommit, EventType: "deposit", AggregateID: aggregateID, AggregateVersion: version, Data: json.RawMessage("{}")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewMsg(subject, sequence, data, ack)
+}
+
+func TestSubscriberWorkersPerKeyOrdering(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+
+	var mu sync.Mutex
+	handled := make(map[string][]int)
+	total := 0
+	subscriber := NewBrokerSubscriber(broker, "account", "", "", "all", log.NewNopLogger(), Handle(func(ctx context.Context, envelope *Envelope) error {
+		//later versions of other keys overtake slow handlers, versions of one key never do
+		time.Sleep(time.Duration(envelope.AggregateVersion%3) * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		handled[envelope.AggregateID] = append(handled[envelope.AggregateID], envelope.AggregateVersion)
+		total++
+		return nil
+	}), SubscriberWorkers(4, PartitionByAggregate))
+
+	for version := 1; version <= 10; version++ {
+		for _, id := range []string{"a1", "a2", "a3", "a4", "a5"} {
+			data, _ := json.Marshal(&Envelope{Status: StatusCommit, AggregateID: id, AggregateVersion: version, Data: json.RawMessage("{}")})
+			broker.Publish("account", data)
+		}
+	}
+	sub := subscriber.Subscribe()
+	if sub == nil {
+		t.Fatal("subscriber is not subscribed")
+	}
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return total == 50
+	})
+	sub.Unsubscribe()
+
+	for id, versions := range handled {
+		for i, version := range versions {
+			if version != i+1 {
+				t.Fatalf("versions of %s are handled in order %v", id, versions)
+			}
+		}
+	}
+}
+
+func TestWorkerPoolKeysRunConcurrently(t *testing.T) {
+	release := make(chan struct{})
+	pool := newWorkerPool(2, 4, PartitionByAggregate, false, func(msg *Msg) {
+		envelope, _ := UnmarshalEnvelope(msg.Data)
+		if envelope.AggregateID == "blocked" {
+			<-release
+		} else {
+			close(release)
+		}
+	})
+	blocked := aggregateMsg(t, "account", 1, "blocked", 1, nil)
+	var other *Msg
+	for i := 0; other == nil; i++ {
+		candidate := aggregateMsg(t, "account", 2, fmt.Sprintf("other-%d", i), 1, nil)
+		if pool.partition(candidate) != pool.partition(blocked) {
+			other = candidate
+		}
+	}
+
+	pool.dispatch(blocked)
+	pool.dispatch(other)
+	done := make(chan struct{})
+	go func() {
+		pool.stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message of another key waits for blocked key")
+	}
+}
+
+func TestWorkerPoolFailure(t *testing.T) {
+	var mu sync.Mutex
+	acked := make(map[uint64]bool)
+	var handled []uint64
+	pool := newWorkerPool(2, 8, PartitionByAggregate, false, Handle(func(ctx context.Context, envelope *Envelope) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, uint64(envelope.AggregateVersion))
+		if envelope.AggregateVersion == 2 {
+			return errors.New("handler failed")
+		}
+		return nil
+	}))
+	for version := 1; version <= 3; version++ {
+		sequence := uint64(version)
+		pool.dispatch(aggregateMsg(t, "account", sequence, "a1", version, func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			acked[sequence] = true
+			return nil
+		}))
+	}
+	pool.stop()
+
+	if fmt.Sprint(handled) != "[1 2 3]" {
+		t.Fatalf("handled %v, expected every message in order", handled)
+	}
+	if !acked[1] || acked[2] || !acked[3] {
+		t.Fatalf("acknowledged %v, failed message must stay unacknowledged for redelivery", acked)
+	}
+
+	//stopped pool drops messages, broker redelivers them to the next subscription
+	pool.dispatch(aggregateMsg(t, "account", 4, "a1", 4, nil))
+	if len(handled) != 3 {
+		t.Fatal("stopped pool handles message")
+	}
+}
+
+func TestSubscriberWorkersRedeliverFailedMessage(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+
+	var mu sync.Mutex
+	attempts := 0
+	var versions []int
+	subscriber := NewBrokerSubscriber(broker, "account", "", "", "all", log.NewNopLogger(), Handle(func(ctx context.Context, envelope *Envelope) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if envelope.AggregateVersion == 1 {
+			if attempts++; attempts == 1 {
+				return errors.New("handler failed")
+			}
+		}
+		versions = append(versions, envelope.AggregateVersion)
+		return nil
+	}), SubscriberWorkers(2, PartitionByAggregate), SubscriberManualAck(50*time.Millisecond))
+
+	data, _ := json.Marshal(&Envelope{Status: StatusCommit, AggregateID: "a1", AggregateVersion: 1, Data: json.RawMessage("{}")})
+	broker.Publish("account", data)
+	sub := subscriber.Subscribe()
+	defer sub.Unsubscribe()
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(versions) == 1
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 2 {
+		t.Fatalf("failed message is handled %d times, expected 2", attempts)
+	}
+}
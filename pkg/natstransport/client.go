@@ -0,0 +1,86 @@
+package natstransport
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+	"github.com/nats-io/nats.go"
+)
+
+const defaultTimeout = 10 * time.Second
+
+//Client wraps a nats subject and provides a method that implements endpoint.Endpoint
+type Client struct {
+	nc      *nats.Conn
+	subject string
+	enc     EncodeRequestFunc
+	dec     DecodeResponseFunc
+	before  []RequestFunc
+	timeout time.Duration
+}
+
+//ClientOption sets optional parameter of Client
+type ClientOption func(*Client)
+
+//ClientBefore functions are executed on request message after it is encoded
+func ClientBefore(before ...RequestFunc) ClientOption {
+	return func(c *Client) { c.before = append(c.before, before...) }
+}
+
+//ClientTimeout sets request timeout used when context has no deadline, default is 10 seconds
+func ClientTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) { c.timeout = timeout }
+}
+
+//NewClient to create new Client, ids and deadline of context are sent in request headers
+func NewClient(nc *nats.Conn, subject string, enc EncodeRequestFunc, dec DecodeResponseFunc, opts ...ClientOption) *Client {
+	c := &Client{
+		nc:      nc,
+		subject: subject,
+		enc:     enc,
+		dec:     dec,
+		before:  []RequestFunc{ContextToNATS},
+		timeout: defaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+//Endpoint returns a usable endpoint that invokes the remote endpoint.
+//Error reply is returned as error of package error with its original kind, timeout is a REQUESTTIMEOUT error.
+func (c *Client) Endpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+		}
+
+		msg := nats.NewMsg(c.subject)
+		if err := c.enc(ctx, msg, request); err != nil {
+			return nil, err
+		}
+		for _, f := range c.before {
+			ctx = f(ctx, msg)
+		}
+
+		reply, err := c.nc.RequestMsgWithContext(ctx, msg)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded), errors.Is(err, nats.ErrTimeout):
+			return nil, rError.New(err, rError.Enum.REQUESTTIMEOUT, "request_timeout")
+		case errors.Is(err, nats.ErrNoResponders):
+			return nil, rError.New(err, rError.Enum.SERVICEUNAVAILABLE, "no_responders")
+		case err != nil:
+			return nil, err
+		}
+		if err = decodeError(reply); err != nil {
+			return nil, err
+		}
+		return c.dec(ctx, reply)
+	}
+}
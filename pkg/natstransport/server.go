@@ -0,0 +1,98 @@
+package natstransport
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+	"github.com/nats-io/nats.go"
+)
+
+//Server wraps an endpoint and serves it to nats requests
+type Server struct {
+	e      endpoint.Endpoint
+	dec    DecodeRequestFunc
+	enc    EncodeResponseFunc
+	before []RequestFunc
+	logger log.Logger
+}
+
+//ServerOption sets optional parameter of Server
+type ServerOption func(*Server)
+
+//ServerBefore functions are executed on request message before it is decoded
+func ServerBefore(before ...RequestFunc) ServerOption {
+	return func(s *Server) { s.before = append(s.before, before...) }
+}
+
+//ServerErrorLogger log errors of decoding, endpoint, encoding and replying
+func ServerErrorLogger(logger log.Logger) ServerOption {
+	return func(s *Server) { s.logger = logger }
+}
+
+//NewServer to create new Server, ids of request headers are moved into context
+func NewServer(e endpoint.Endpoint, dec DecodeRequestFunc, enc EncodeResponseFunc, opts ...ServerOption) *Server {
+	s := &Server{
+		e:      e,
+		dec:    dec,
+		enc:    enc,
+		before: []RequestFunc{NATSToContext},
+		logger: log.NewNopLogger(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+//Serve subscribe subject within queue group, empty queue subscribes every instance
+func (s *Server) Serve(nc *nats.Conn, subject, queue string) (*nats.Subscription, error) {
+	if queue == "" {
+		return nc.Subscribe(subject, s.MsgHandler(nc))
+	}
+	return nc.QueueSubscribe(subject, queue, s.MsgHandler(nc))
+}
+
+//MsgHandler return nats message handler replying through connection
+func (s *Server) MsgHandler(nc *nats.Conn) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		ctx := context.Background()
+		if deadline, ok := deadline(msg); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+			defer cancel()
+		}
+		for _, f := range s.before {
+			ctx = f(ctx, msg)
+		}
+
+		reply := nats.NewMsg(msg.Reply)
+		if err := s.serve(ctx, msg, reply); err != nil {
+			s.logger.Log("nats", "Error when serving request on subject: "+msg.Subject, "err", err)
+			reply = nats.NewMsg(msg.Reply)
+			encodeError(reply, err)
+		}
+		if msg.Reply == "" {
+			return
+		}
+		if err := nc.PublishMsg(reply); err != nil {
+			s.logger.Log("nats", "Error when replying request on subject: "+msg.Subject, "err", err)
+		}
+	}
+}
+
+func (s *Server) serve(ctx context.Context, msg *nats.Msg, reply *nats.Msg) error {
+	request, err := s.dec(ctx, msg)
+	if err != nil {
+		if _, ok := err.(*rError.Error); !ok {
+			err = rError.New(err, rError.Enum.BADREQUEST, "bad_request")
+		}
+		return err
+	}
+	response, err := s.e(ctx, request)
+	if err != nil {
+		return err
+	}
+	return s.enc(ctx, reply, response)
+}
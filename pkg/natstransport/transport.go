@@ -0,0 +1,134 @@
+//Package natstransport binds go-kit endpoints to core nats request/reply.
+//Errors of package error keep their kind across the wire, request and trace ids travel in message headers.
+package natstransport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+	"github.com/johnjerrico/gokit-starter-pack/pkg/trace"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	//HeaderErrorKind reply header carrying kind of error
+	HeaderErrorKind = "X-Error-Kind"
+	//HeaderErrorMessage reply header carrying message of error
+	HeaderErrorMessage = "X-Error-Message"
+	//HeaderDeadline request header carrying caller deadline as unix nano
+	HeaderDeadline = "X-Deadline"
+)
+
+//DecodeRequestFunc extract request object from request message
+type DecodeRequestFunc func(ctx context.Context, msg *nats.Msg) (request interface{}, err error)
+
+//EncodeResponseFunc encode response object into reply message
+type EncodeResponseFunc func(ctx context.Context, reply *nats.Msg, response interface{}) error
+
+//EncodeRequestFunc encode request object into request message
+type EncodeRequestFunc func(ctx context.Context, msg *nats.Msg, request interface{}) error
+
+//DecodeResponseFunc extract response object from reply message
+type DecodeResponseFunc func(ctx context.Context, reply *nats.Msg) (response interface{}, err error)
+
+//RequestFunc may take information from message and put it into context, or the other way around
+type RequestFunc func(ctx context.Context, msg *nats.Msg) context.Context
+
+//EncodeJSONRequest encode request as json
+func EncodeJSONRequest(_ context.Context, msg *nats.Msg, request interface{}) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	msg.Data = data
+	return nil
+}
+
+//EncodeJSONResponse encode response as json
+func EncodeJSONResponse(_ context.Context, reply *nats.Msg, response interface{}) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	reply.Data = data
+	return nil
+}
+
+//errorBody body of error reply
+type errorBody struct {
+	Error   string `json:"error"`
+	Kind    int    `json:"kind"`
+	Message string `json:"message"`
+}
+
+//encodeError write kind and message of error into reply headers and body, error without kind is an internal server error
+func encodeError(reply *nats.Msg, err error) {
+	var e *rError.Error
+	if !errors.As(err, &e) {
+		e = rError.New(err, rError.Enum.INTERNALSERVERERROR, "internal_server_error")
+	}
+	reply.Header.Set(HeaderErrorKind, strconv.Itoa(e.Kind()))
+	reply.Header.Set(HeaderErrorMessage, e.Message())
+	reply.Data, _ = json.Marshal(errorBody{Error: e.Error(), Kind: e.Kind(), Message: e.Message()})
+}
+
+//decodeError restore error of reply, returns nil when reply is not an error
+func decodeError(reply *nats.Msg) error {
+	header := reply.Header.Get(HeaderErrorKind)
+	if header == "" {
+		return nil
+	}
+	kind, err := strconv.Atoi(header)
+	if err != nil {
+		return rError.New(err, rError.Enum.BADGATEWAY, "invalid_error_reply")
+	}
+	var body errorBody
+	if err = json.Unmarshal(reply.Data, &body); err != nil || body.Error == "" {
+		body.Error = reply.Header.Get(HeaderErrorMessage)
+	}
+	return rError.New(errors.New(body.Error), kind, reply.Header.Get(HeaderErrorMessage))
+}
+
+//ContextToNATS move request, correlation and trace ids and deadline from context into message headers
+func ContextToNATS(ctx context.Context, msg *nats.Msg) context.Context {
+	if ids, ok := trace.FromContext(ctx); ok {
+		for header, value := range map[string]string{
+			trace.HeaderRequestID:     ids.RequestID,
+			trace.HeaderCorrelationID: ids.CorrelationID,
+			trace.HeaderTraceID:       ids.TraceID,
+		} {
+			if value != "" {
+				msg.Header.Set(header, value)
+			}
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		msg.Header.Set(HeaderDeadline, strconv.FormatInt(deadline.UnixNano(), 10))
+	}
+	return ctx
+}
+
+//NATSToContext move ids from message headers into context, caller deadline is applied by server
+func NATSToContext(ctx context.Context, msg *nats.Msg) context.Context {
+	ids := trace.IDs{
+		RequestID:     msg.Header.Get(trace.HeaderRequestID),
+		CorrelationID: msg.Header.Get(trace.HeaderCorrelationID),
+		TraceID:       msg.Header.Get(trace.HeaderTraceID),
+	}
+	if ids.IsEmpty() {
+		return ctx
+	}
+	return trace.NewContext(ctx, ids)
+}
+
+func deadline(msg *nats.Msg) (time.Time, bool) {
+	nanos, err := strconv.ParseInt(msg.Header.Get(HeaderDeadline), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
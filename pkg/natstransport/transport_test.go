@@ -0,0 +1,150 @@
+package natstransport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+	"github.com/johnjerrico/gokit-starter-pack/pkg/trace"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+func runNATS(t *testing.T) *nats.Conn {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server is not ready")
+	}
+	t.Cleanup(srv.Shutdown)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+func decodeGreeting(_ context.Context, msg *nats.Msg) (interface{}, error) {
+	var request greeting
+	if err := json.Unmarshal(msg.Data, &request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+//serve endpoint on subject, it is called with decoded greeting
+func serve(t *testing.T, nc *nats.Conn, subject string, e func(ctx context.Context, request greeting) (interface{}, error)) {
+	t.Helper()
+	srv := NewServer(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return e(ctx, request.(greeting))
+	}, decodeGreeting, EncodeJSONResponse)
+	sub, err := srv.Serve(nc, subject, "greeter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sub.Unsubscribe() })
+	if err = nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func greetingClient(nc *nats.Conn, subject string, opts ...ClientOption) *Client {
+	return NewClient(nc, subject, EncodeJSONRequest, decodeGreeting, opts...)
+}
+
+func TestRequestReply(t *testing.T) {
+	nc := runNATS(t)
+	var ids trace.IDs
+	var deadline time.Time
+	serve(t, nc, "greet", func(ctx context.Context, request greeting) (interface{}, error) {
+		ids, _ = trace.FromContext(ctx)
+		deadline, _ = ctx.Deadline()
+		return greeting{Name: "hello " + request.Name}, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = trace.NewContext(ctx, trace.IDs{RequestID: "r1", CorrelationID: "c1", TraceID: "t1"})
+	response, err := greetingClient(nc, "greet").Endpoint()(ctx, greeting{Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != (greeting{Name: "hello alice"}) {
+		t.Fatalf("client decoded %+v", response)
+	}
+	if ids != (trace.IDs{RequestID: "r1", CorrelationID: "c1", TraceID: "t1"}) {
+		t.Fatalf("server received ids %+v", ids)
+	}
+	if expected, _ := ctx.Deadline(); !deadline.Equal(expected) {
+		t.Fatalf("server deadline %v, expected caller deadline %v", deadline, expected)
+	}
+}
+
+func TestErrorReply(t *testing.T) {
+	nc := runNATS(t)
+	serve(t, nc, "greet", func(ctx context.Context, request greeting) (interface{}, error) {
+		switch request.Name {
+		case "unknown":
+			return nil, rError.New(errors.New("user unknown is not found"), rError.Enum.NOTFOUND, "user_not_found")
+		case "broken":
+			return nil, errors.New("database is down")
+		}
+		return request, nil
+	})
+	nc.Subscribe("greet.raw", func(msg *nats.Msg) {
+		reply := nats.NewMsg(msg.Reply)
+		reply.Header.Set(HeaderErrorKind, "not a kind")
+		nc.PublishMsg(reply)
+	})
+
+	tests := []struct {
+		name    string
+		subject string
+		request interface{}
+		kind    int
+		message string
+	}{
+		{name: "kind is kept", subject: "greet", request: greeting{Name: "unknown"}, kind: rError.Enum.NOTFOUND, message: "user_not_found"},
+		{name: "error without kind", subject: "greet", request: greeting{Name: "broken"}, kind: rError.Enum.INTERNALSERVERERROR, message: "internal_server_error"},
+		{name: "undecodable request", subject: "greet", request: []string{"alice"}, kind: rError.Enum.BADREQUEST, message: "bad_request"},
+		{name: "invalid error reply", subject: "greet.raw", request: greeting{}, kind: rError.Enum.BADGATEWAY, message: "invalid_error_reply"},
+		{name: "no responders", subject: "nobody", request: greeting{}, kind: rError.Enum.SERVICEUNAVAILABLE, message: "no_responders"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := greetingClient(nc, test.subject).Endpoint()(context.Background(), test.request)
+			rerr, ok := err.(*rError.Error)
+			if !ok || rerr.Kind() != test.kind || rerr.Message() != test.message {
+				t.Fatalf("client returned %v, %v, expected %d %s", response, err, test.kind, test.message)
+			}
+		})
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	nc := runNATS(t)
+	release := make(chan struct{})
+	defer close(release)
+	serve(t, nc, "greet", func(ctx context.Context, request greeting) (interface{}, error) {
+		<-release
+		return request, nil
+	})
+
+	_, err := greetingClient(nc, "greet", ClientTimeout(50*time.Millisecond)).Endpoint()(context.Background(), greeting{Name: "alice"})
+	if rerr, ok := err.(*rError.Error); !ok || rerr.Kind() != rError.Enum.REQUESTTIMEOUT {
+		t.Fatalf("client returned %v, expected REQUESTTIMEOUT", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/metrics"
+	"github.com/johnjerrico/gokit-starter-pack/pkg/trace"
 )
 
 //Request ...
@@ -73,13 +74,17 @@ func (m Logger) Log(
 	return func(ctx context.Context, request interface{}) (resp interface{}, err error) {
 		defer func(begin time.Time) {
 			jsonString, _ := json.Marshal(request)
-			m.logger.Log(
+			keyvals := []interface{}{
 				"method", method,
 				"action", action,
 				"params", jsonString,
 				"took", time.Since(begin),
 				"err", err,
-			)
+			}
+			if ids, ok := trace.FromContext(ctx); ok {
+				keyvals = append(keyvals, ids.Keyvals()...)
+			}
+			m.logger.Log(keyvals...)
 		}(time.Now())
 		return f(ctx, request)
 	}
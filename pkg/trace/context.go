@@ -0,0 +1,91 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type key int
+
+const idsKey key = 0
+
+const (
+	//HeaderRequestID http header carrying request id
+	HeaderRequestID = "X-Request-ID"
+	//HeaderCorrelationID http header carrying correlation id
+	HeaderCorrelationID = "X-Correlation-ID"
+	//HeaderTraceID http header carrying trace id
+	HeaderTraceID = "X-Trace-ID"
+)
+
+// IDs identifiers shared by logs and events of the same request
+type IDs struct {
+	RequestID     string
+	CorrelationID string
+	TraceID       string
+}
+
+// IsEmpty ...
+func (ids IDs) IsEmpty() bool {
+	return ids.RequestID == "" && ids.CorrelationID == "" && ids.TraceID == ""
+}
+
+// Keyvals return non empty ids as go-kit log key values
+func (ids IDs) Keyvals() []interface{} {
+	var keyvals []interface{}
+	if ids.RequestID != "" {
+		keyvals = append(keyvals, "request_id", ids.RequestID)
+	}
+	if ids.CorrelationID != "" {
+		keyvals = append(keyvals, "correlation_id", ids.CorrelationID)
+	}
+	if ids.TraceID != "" {
+		keyvals = append(keyvals, "trace_id", ids.TraceID)
+	}
+	return keyvals
+}
+
+// NewContext ...
+func NewContext(ctx context.Context, ids IDs) context.Context {
+	return context.WithValue(ctx, idsKey, ids)
+}
+
+// FromContext ...
+func FromContext(ctx context.Context) (IDs, bool) {
+	ids, ok := ctx.Value(idsKey).(IDs)
+	return ids, ok
+}
+
+// HTTPToContext go-kit http RequestFunc moving ids from request headers into context, missing request id is generated
+func HTTPToContext(ctx context.Context, r *http.Request) context.Context {
+	ids := IDs{
+		RequestID:     r.Header.Get(HeaderRequestID),
+		CorrelationID: r.Header.Get(HeaderCorrelationID),
+		TraceID:       r.Header.Get(HeaderTraceID),
+	}
+	if ids.RequestID == "" {
+		ids.RequestID = uuid.New().String()
+	}
+	if ids.CorrelationID == "" {
+		ids.CorrelationID = ids.RequestID
+	}
+	return NewContext(ctx, ids)
+}
+
+// ContextToHTTP go-kit http RequestFunc moving ids from context into outgoing request headers
+func ContextToHTTP(ctx context.Context, r *http.Request) context.Context {
+	if ids, ok := FromContext(ctx); ok {
+		for header, value := range map[string]string{
+			HeaderRequestID:     ids.RequestID,
+			HeaderCorrelationID: ids.CorrelationID,
+			HeaderTraceID:       ids.TraceID,
+		} {
+			if value != "" {
+				r.Header.Set(header, value)
+			}
+		}
+	}
+	return ctx
+}
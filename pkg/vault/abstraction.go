@@ -1,8 +1,27 @@
 package vault
 
-//IVault ...
+import "context"
+
+//KV read and write secrets of vault kv engine, reading missing path returns nil data without error
+type KV interface {
+	Read(ctx context.Context, path string) (map[string]interface{}, error)
+	Write(ctx context.Context, path string, data map[string]interface{}) error
+}
+
+//Transit encrypt and decrypt with vault transit engine without storing value
+type Transit interface {
+	Encrypt(ctx context.Context, transitkey string, plaintext []byte) (string, error)
+	Decrypt(ctx context.Context, transitkey, ciphertext string) ([]byte, error)
+}
+
+//IVault client of vault, implemented by *Vault and by vaulttest.Fake for unit tests
 type IVault interface {
-	GetEnvOrDefaultConfig(path string, def interface{})
-	WriteEncrypted(transitkey, path, value []byte)
-	ReadEncrypted(transitkey, path string)
+	KV
+	Transit
+	GetEnvOrDefaultConfig(ctx context.Context, path string, def interface{}) (map[string]string, error)
+	LoadConfig(ctx context.Context, path string, dst interface{}) error
+	WriteEncrypted(ctx context.Context, transitkey, path string, value []byte) (string, error)
+	ReadEncrypted(ctx context.Context, transitkey, path string) ([]byte, error)
 }
+
+var _ IVault = (*Vault)(nil)
@@ -1,16 +1,17 @@
 package vault
 
 import (
-	"bytes"
+	"context"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"net/http"
 	"os"
 	"reflect"
 
 	"github.com/google/uuid"
 	"github.com/hashicorp/vault/api"
+	"github.com/johnjerrico/gokit-starter-pack/pkg/config"
 	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
 )
 
@@ -49,106 +50,221 @@ func New() (*Vault, error) {
 	return &Vault{c}, nil
 }
 
-// GetEnvOrDefaultConfig get configuration from Vault
-func (c *Vault) GetEnvOrDefaultConfig(path string, def interface{}) (map[string]string, error) {
+// GetEnvOrDefaultConfig get configuration from Vault as strings, see GetConfig
+func (c *Vault) GetEnvOrDefaultConfig(ctx context.Context, path string, def interface{}) (map[string]string, error) {
 	var err error
-	res := make(map[string]string)
 
 	if c == nil {
 		return nil, rError.New(err, rError.Enum.INTERNALSERVERERROR, "client_has_not_been_initiated")
 	}
 
-	// Parsing interface to map
-	s := reflect.ValueOf(def).Elem()
-	typeOfT := s.Type()
+	return GetConfig(ctx, c, path, def)
+}
+
+// LoadConfig fill configuration struct dst in place from k/v of config/global, then config/{path} and then environment,
+// see config.Load for `vault`, `env` and `default` tags
+func (c *Vault) LoadConfig(ctx context.Context, path string, dst interface{}) error {
+	var err error
 
-	for i := 0; i < s.NumField(); i++ {
-		f := s.Field(i)
-		res[typeOfT.Field(i).Name] = f.Interface().(string)
+	if c == nil {
+		return rError.New(err, rError.Enum.INTERNALSERVERERROR, "client_has_not_been_initiated")
 	}
 
-	// Read Config from config/global vault
-	kv, err := c.Logical().Read("config/global")
+	return LoadConfig(ctx, c, path, dst)
+}
+
+// LoadConfig fill configuration struct dst in place from k/v of kv, see (*Vault).LoadConfig
+func LoadConfig(ctx context.Context, kv KV, path string, dst interface{}) error {
+	return WithConfig(config.NewLoader(), kv, path).With(config.LayerEnv, config.Env()).Load(ctx, dst)
+}
+
+// WithConfig add config/global and config/{path} of kv into loader layers
+func WithConfig(loader *config.Loader, kv KV, path string) *config.Loader {
+	return loader.
+		With(config.LayerVaultGlobal, ConfigSource(kv, "config/global")).
+		With(config.LayerVaultPath, ConfigSource(kv, "config/"+path))
+}
+
+// ConfigSource config source reading k/v of vault path, missing path has no values
+func ConfigSource(kv KV, path string) config.Source {
+	return &configSource{kv: kv, path: path}
+}
+
+type configSource struct {
+	kv   KV
+	path string
+	data map[string]interface{}
+}
+
+func (s *configSource) Name() string { return "vault " + s.path }
+
+func (s *configSource) Fetch(ctx context.Context) error {
+	data, err := s.kv.Read(ctx, s.path)
 
 	if err != nil {
+		return err
+	}
+
+	s.data = data
+
+	return nil
+}
+
+func (s *configSource) Lookup(field config.Field) (interface{}, bool) {
+	return config.Map(s.Name(), s.data).Lookup(field)
+}
+
+// GetConfig load configuration like LoadConfig into copy of default configuration struct def and return its fields
+// as strings keyed by dot separated field name, ex: Database.Host (see config.Strings). def must be pointer to struct
+// and is left untouched. Use LoadConfig to fill typed struct in place, GetConfig serves callers reading strings.
+func GetConfig(ctx context.Context, kv KV, path string, def interface{}) (map[string]string, error) {
+	v := reflect.ValueOf(def)
+
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, rError.New(fmt.Errorf("default configuration must be pointer to struct, got %T", def), rError.Enum.INTERNALSERVERERROR, "invalid_default_config")
+	}
+
+	cfg := copyStruct(v.Elem())
+
+	if err := LoadConfig(ctx, kv, path, cfg.Addr().Interface()); err != nil {
 		return nil, err
 	}
 
-	if kv != nil {
-		for k := range res {
-			if kv.Data[k] != nil {
-				res[k] = kv.Data[k].(string)
-			}
+	return config.Strings(cfg.Addr().Interface())
+}
+
+// copyStruct copy struct value, exported pointers of nested struct are copied as well so loading the copy leaves v untouched
+func copyStruct(v reflect.Value) reflect.Value {
+	cp := reflect.New(v.Type()).Elem()
+	cp.Set(v)
+
+	for i := 0; i < cp.NumField(); i++ {
+		f := cp.Field(i)
+
+		if !v.Type().Field(i).IsExported() {
+			continue
+		}
+
+		switch {
+		case f.Kind() == reflect.Struct:
+			f.Set(copyStruct(f))
+		case f.Kind() == reflect.Ptr && !f.IsNil() && f.Elem().Kind() == reflect.Struct:
+			f.Set(copyStruct(f.Elem()).Addr())
 		}
 	}
 
-	// Read Config from config/{path} vault
-	kv, err = c.Logical().Read("config/" + path)
+	return cp
+}
 
-	if err != nil {
+// Read read k/v of path, it returns nil data when path does not exist
+func (c *Vault) Read(ctx context.Context, path string) (map[string]interface{}, error) {
+	var err error
+
+	if c == nil {
+		return nil, rError.New(err, rError.Enum.INTERNALSERVERERROR, "client_has_not_been_initiated")
+	}
+
+	secret, err := c.request(ctx, "GET", "/v1/"+path, nil)
+
+	if isNotFound(err) {
+		return nil, nil
+	}
+
+	if err != nil || secret == nil {
 		return nil, err
 	}
 
-	if kv != nil {
-		for k := range res {
-			if kv.Data[k] != nil {
-				res[k] = kv.Data[k].(string)
-			}
-		}
+	return secret.Data, nil
+}
+
+// Write write k/v into path
+func (c *Vault) Write(ctx context.Context, path string, data map[string]interface{}) error {
+	var err error
+
+	if c == nil {
+		return rError.New(err, rError.Enum.INTERNALSERVERERROR, "client_has_not_been_initiated")
 	}
 
-	return res, nil
+	_, err = c.request(ctx, "PUT", "/v1/"+path, data)
+
+	return err
 }
 
-// WriteEncrypted write k/v with encrypted value in vault
-func (c *Vault) WriteEncrypted(transitkey, path string, value []byte) (string, error) {
+// Encrypt encrypt plaintext with transit key and return its ciphertext, vault creates missing transit key when policy allows it.
+// Missing transit mount fails with NOTFOUND error
+func (c *Vault) Encrypt(ctx context.Context, transitkey string, plaintext []byte) (string, error) {
 	var err error
-	var response Response
 
 	if c == nil {
 		return "", rError.New(err, rError.Enum.INTERNALSERVERERROR, "client_has_not_been_initiated")
 	}
 
-	reqBody, _ := json.Marshal(map[string]string{
-		"plaintext": base64.StdEncoding.EncodeToString(value),
+	secret, err := c.request(ctx, "POST", fmt.Sprintf("/v1/transit/encrypt/%v", transitkey), map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(plaintext),
 	})
 
-	uri := fmt.Sprintf("/v1/transit/encrypt/%v", transitkey)
+	if err != nil {
+		return "", err
+	}
+
+	// Get Ciphertext from Response
+	ciphertext, ok := transitField(secret, "ciphertext")
+
+	if !ok || ciphertext == "" {
+		return "", rError.New(fmt.Errorf("vault transit encrypt with key %s returned no ciphertext", transitkey), rError.Enum.BADGATEWAY, "invalid_transit_response")
+	}
 
-	req := c.NewRequest("POST", uri)
-	req.Body = bytes.NewBuffer(reqBody)
+	return ciphertext, nil
+}
+
+// Decrypt decrypt ciphertext with transit key and return its plaintext, missing transit key fails with error of vault
+// and missing transit mount fails with NOTFOUND error
+func (c *Vault) Decrypt(ctx context.Context, transitkey, ciphertext string) ([]byte, error) {
+	var err error
+
+	if c == nil {
+		return nil, rError.New(err, rError.Enum.INTERNALSERVERERROR, "client_has_not_been_initiated")
+	}
 
-	res, err := c.RawRequest(req)
+	secret, err := c.request(ctx, "POST", fmt.Sprintf("/v1/transit/decrypt/%v", transitkey), map[string]interface{}{
+		"ciphertext": ciphertext,
+	})
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	defer res.Body.Close()
+	// Get Plaintext from Response
+	plaintext, ok := transitField(secret, "plaintext")
 
-	body, err := ioutil.ReadAll(res.Body)
+	if !ok {
+		return nil, rError.New(fmt.Errorf("vault transit decrypt with key %s returned no plaintext", transitkey), rError.Enum.BADGATEWAY, "invalid_transit_response")
+	}
 
-	if err != nil {
-		return "", err
+	return base64.StdEncoding.DecodeString(plaintext)
+}
+
+// WriteEncrypted write k/v with encrypted value in vault
+func (c *Vault) WriteEncrypted(ctx context.Context, transitkey, path string, value []byte) (string, error) {
+	var err error
+
+	if c == nil {
+		return "", rError.New(err, rError.Enum.INTERNALSERVERERROR, "client_has_not_been_initiated")
 	}
 
-	// Pass a pointer of type Response and Go'll do the rest
-	err = json.Unmarshal(body, &response)
+	ciphertext, err := c.Encrypt(ctx, transitkey, value)
 
 	if err != nil {
 		return "", err
 	}
 
-	// Get Ciphertext from Response
-	ciphertext := response.Data["ciphertext"].(string)
-
 	data := map[string]interface{}{
 		"value": ciphertext,
 	}
 
 	id, _ := uuid.NewUUID()
 
-	_, err = c.Logical().Write(fmt.Sprintf(`%v/%v`, path, id.String()), data)
+	err = c.Write(ctx, fmt.Sprintf(`%v/%v`, path, id.String()), data)
 
 	if err != nil {
 		return "", err
@@ -157,61 +273,77 @@ func (c *Vault) WriteEncrypted(transitkey, path string, value []byte) (string, e
 	return id.String(), nil
 }
 
-// ReadEncrypted ...
-func (c *Vault) ReadEncrypted(transitkey, path string) ([]byte, error) {
+// ReadEncrypted read k/v written by WriteEncrypted and decrypt its value, it returns nil value when path does not exist
+// and NOTFOUND error when path has no value
+func (c *Vault) ReadEncrypted(ctx context.Context, transitkey, path string) ([]byte, error) {
 	var err error
-	var resp Response
 
 	if c == nil {
 		return nil, rError.New(err, rError.Enum.INTERNALSERVERERROR, "client_has_not_been_initiated")
 	}
 
-	data, err := c.Logical().Read(path)
+	data, err := c.Read(ctx, path)
 
-	if err != nil {
+	if err != nil || data == nil {
 		return nil, err
 	}
 
-	if data == nil {
-		return nil, err
+	ciphertext, ok := data["value"].(string)
+
+	if !ok {
+		return nil, rError.New(fmt.Errorf("vault path %s has no value", path), rError.Enum.NOTFOUND, "vault_value_not_found")
 	}
 
-	reqBody, _ := json.Marshal(map[string]string{
-		"ciphertext": data.Data["value"].(string),
-	})
+	return c.Decrypt(ctx, transitkey, ciphertext)
+}
 
-	uri := fmt.Sprintf("/v1/transit/decrypt/%v", transitkey)
+// transitField get string field of transit response
+func transitField(secret *api.Secret, field string) (string, bool) {
+	if secret == nil {
+		return "", false
+	}
 
-	req := c.NewRequest("POST", uri)
-	req.Body = bytes.NewBuffer(reqBody)
+	value, ok := secret.Data[field].(string)
 
-	res, err := c.RawRequest(req)
+	return value, ok
+}
 
-	if err != nil {
-		return nil, err
-	}
+// isNotFound check whether error is not found path of request
+func isNotFound(err error) bool {
+	rerr, ok := err.(*rError.Error)
 
-	defer res.Body.Close()
+	return ok && rerr.Kind() == rError.Enum.NOTFOUND
+}
 
-	body, err := ioutil.ReadAll(res.Body)
+// request send request with json body and parse its secret, not found path fails with NOTFOUND error
+func (c *Vault) request(ctx context.Context, method, path string, body map[string]interface{}) (*api.Secret, error) {
+	req := c.NewRequest(method, path)
 
-	if err != nil {
-		return nil, err
+	if body != nil {
+		if err := req.SetJSONBody(body); err != nil {
+			return nil, err
+		}
 	}
 
-	// Pass a pointer of type Response and Go'll do the rest
-	err = json.Unmarshal(body, &resp)
+	res, err := c.RawRequestWithContext(ctx, req)
 
-	if err != nil {
-		return nil, err
+	if res != nil {
+		defer res.Body.Close()
 	}
 
-	// Get Plaintext from Response
-	plaintextByte, err := base64.StdEncoding.DecodeString(resp.Data["plaintext"].(string))
+	if res != nil && res.StatusCode == http.StatusNotFound {
+		return nil, rError.New(fmt.Errorf("vault path %s not found", path), rError.Enum.NOTFOUND, "vault_path_not_found")
+	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	return plaintextByte, err
+	secret, err := api.ParseSecret(res.Body)
+
+	if err == io.EOF {
+		return nil, nil
+	}
+
+	return secret, err
 }
@@ -0,0 +1,274 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johnjerrico/gokit-starter-pack/pkg/config"
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+)
+
+// server emulate kv and transit engines of vault, transit ciphertext is the plaintext prefixed with the key.
+// Transit key broken gets responses without data and key unmounted behaves as transit engine which is not mounted.
+type server struct {
+	mu sync.Mutex
+	kv map[string]map[string]interface{}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	var data map[string]interface{}
+	switch {
+	case strings.HasPrefix(path, "transit/") && strings.HasSuffix(path, "/unmounted"):
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":["no handler for route"]}`))
+		return
+	case strings.HasPrefix(path, "transit/") && strings.HasSuffix(path, "/broken"):
+		data = map[string]interface{}{}
+	case strings.HasPrefix(path, "transit/encrypt/"):
+		data = map[string]interface{}{"ciphertext": "vault:" + strings.TrimPrefix(path, "transit/encrypt/") + ":" + body["plaintext"].(string)}
+	case strings.HasPrefix(path, "transit/decrypt/"):
+		key := strings.TrimPrefix(path, "transit/decrypt/")
+		ciphertext := body["ciphertext"].(string)
+		if !strings.HasPrefix(ciphertext, "vault:"+key+":") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":["invalid ciphertext"]}`))
+			return
+		}
+		data = map[string]interface{}{"plaintext": strings.TrimPrefix(ciphertext, "vault:"+key+":")}
+	case r.Method == http.MethodPut:
+		s.kv[path] = body
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		var ok bool
+		if data, ok = s.kv[path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func newVault(t *testing.T) *Vault {
+	t.Helper()
+	srv := httptest.NewServer(&server{kv: make(map[string]map[string]interface{})})
+	t.Cleanup(srv.Close)
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "token")
+	v, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func kind(err error) int {
+	if rerr, ok := err.(*rError.Error); ok {
+		return rerr.Kind()
+	}
+	return -1
+}
+
+func TestVaultKV(t *testing.T) {
+	v := newVault(t)
+	ctx := context.Background()
+	if err := v.Write(ctx, "secret/db", map[string]interface{}{"user": "app"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := v.Read(ctx, "secret/db")
+	if err != nil || data["user"] != "app" {
+		t.Fatalf("read %v, err %v", data, err)
+	}
+	if data, err = v.Read(ctx, "secret/missing"); err != nil || data != nil {
+		t.Fatalf("missing path returned %v, err %v", data, err)
+	}
+}
+
+func TestVaultTransit(t *testing.T) {
+	v := newVault(t)
+	ctx := context.Background()
+	ciphertext, err := v.Encrypt(ctx, "users", []byte("3201"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := v.Decrypt(ctx, "users", ciphertext)
+	if err != nil || string(plaintext) != "3201" {
+		t.Fatalf("decrypted %q, err %v", plaintext, err)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		kind int
+	}{
+		{name: "decrypt with other key", call: func() error { _, err := v.Decrypt(ctx, "payments", ciphertext); return err }, kind: -1},
+		{name: "encrypt without ciphertext", call: func() error { _, err := v.Encrypt(ctx, "broken", []byte("x")); return err }, kind: rError.Enum.BADGATEWAY},
+		{name: "decrypt without plaintext", call: func() error { _, err := v.Decrypt(ctx, "broken", "vault:broken:eA=="); return err }, kind: rError.Enum.BADGATEWAY},
+		{name: "encrypt without mount", call: func() error { _, err := v.Encrypt(ctx, "unmounted", []byte("x")); return err }, kind: rError.Enum.NOTFOUND},
+		{name: "decrypt without mount", call: func() error { _, err := v.Decrypt(ctx, "unmounted", "vault:unmounted:eA=="); return err }, kind: rError.Enum.NOTFOUND},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.call()
+			if err == nil || kind(err) != test.kind {
+				t.Fatalf("returned %v, expected kind %d", err, test.kind)
+			}
+		})
+	}
+}
+
+func TestVaultEncrypted(t *testing.T) {
+	v := newVault(t)
+	ctx := context.Background()
+	id, err := v.WriteEncrypted(ctx, "users", "secret/users", []byte("3201"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := v.ReadEncrypted(ctx, "users", "secret/users/"+id)
+	if err != nil || string(value) != "3201" {
+		t.Fatalf("read %q, err %v", value, err)
+	}
+	if value, err = v.ReadEncrypted(ctx, "users", "secret/users/missing"); err != nil || value != nil {
+		t.Fatalf("missing path returned %q, err %v", value, err)
+	}
+	if err = v.Write(ctx, "secret/users/empty", map[string]interface{}{"other": "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if value, err = v.ReadEncrypted(ctx, "users", "secret/users/empty"); kind(err) != rError.Enum.NOTFOUND {
+		t.Fatalf("path without value returned %q, err %v", value, err)
+	}
+}
+
+func TestVaultNotInitiated(t *testing.T) {
+	var v *Vault
+	ctx := context.Background()
+	calls := []func() error{
+		func() error { _, err := v.Read(ctx, "secret/db"); return err },
+		func() error { return v.Write(ctx, "secret/db", nil) },
+		func() error { _, err := v.Encrypt(ctx, "users", nil); return err },
+		func() error { _, err := v.Decrypt(ctx, "users", ""); return err },
+		func() error { _, err := v.ReadEncrypted(ctx, "users", "secret/db"); return err },
+	}
+	for i, call := range calls {
+		if err := call(); kind(err) != rError.Enum.INTERNALSERVERERROR {
+			t.Fatalf("call %d on nil client returned %v", i, err)
+		}
+	}
+}
+
+type testConfig struct {
+	Address  string `vault:"address"`
+	Timeout  time.Duration
+	Brokers  []string `env:"TEST_VAULT_BROKERS"`
+	Database *struct {
+		Host string `vault:"host"`
+		Port int    `vault:"port"`
+	} `vault:"database"`
+	internal string
+}
+
+func TestGetConfig(t *testing.T) {
+	v := newVault(t)
+	ctx := context.Background()
+	if err := v.Write(ctx, "config/global", map[string]interface{}{"address": ":8080", "Timeout": "5s", "database": map[string]interface{}{"host": "global", "port": 5432}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Write(ctx, "config/svc", map[string]interface{}{"database": map[string]interface{}{"host": "db"}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_VAULT_BROKERS", "a,b")
+
+	def := &testConfig{Address: ":9080", Timeout: time.Second, internal: "x"}
+	def.Database = &struct {
+		Host string `vault:"host"`
+		Port int    `vault:"port"`
+	}{Host: "localhost"}
+	cfg, err := v.GetEnvOrDefaultConfig(ctx, "svc", def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"Address": ":8080", "Timeout": "5s", "Brokers": "a,b", "Database.Host": "db", "Database.Port": "5432"}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Fatalf("config %v, expected %v", cfg, expected)
+	}
+	if def.Address != ":9080" || def.Database.Host != "localhost" || def.Database.Port != 0 {
+		t.Fatalf("default configuration is changed into %+v %+v", def, def.Database)
+	}
+
+	for _, invalid := range []interface{}{nil, testConfig{}, (*testConfig)(nil), new(string)} {
+		if _, err = GetConfig(ctx, v, "svc", invalid); kind(err) != rError.Enum.INTERNALSERVERERROR {
+			t.Fatalf("default configuration %T returned %v", invalid, err)
+		}
+	}
+
+	if err = v.Write(ctx, "config/svc", map[string]interface{}{"database": map[string]interface{}{"port": "abc"}}); err != nil {
+		t.Fatal(err)
+	}
+	var fieldErr *config.FieldError
+	if _, err = GetConfig(ctx, v, "svc", &testConfig{}); !errors.As(err, &fieldErr) || fieldErr.Field != "Database.Port" {
+		t.Fatalf("invalid value returned %v", err)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	v := newVault(t)
+	ctx := context.Background()
+	type layers struct {
+		Default string `default:"default"`
+		File    string `default:"default"`
+		Global  string `default:"default"`
+		Path    string `default:"default"`
+		Env     string `default:"default"`
+		Flag    string `default:"default"`
+	}
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte("file: file\nglobal: file\npath: file\nenv: file\nflag: file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Write(ctx, "config/global", map[string]interface{}{"global": "global", "path": "global", "env": "global", "flag": "global"}); err != nil {
+		t.Fatal(err)
+	}
+	//null value of vault path leaves value of vault global
+	if err := v.Write(ctx, "config/svc", map[string]interface{}{"global": nil, "path": "path", "env": "path", "flag": "path"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SVC_ENV", "env")
+	t.Setenv("SVC_FLAG", "env")
+	var cfg layers
+	fs := flag.NewFlagSet("svc", flag.ContinueOnError)
+	config.RegisterFlags(fs, &cfg)
+	if err := fs.Parse([]string{"-flag=flag"}); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := config.NewLoader().
+		With(config.LayerFlags, config.Flags(fs)).
+		With(config.LayerEnv, config.EnvPrefix("SVC")).
+		With(config.LayerFile, config.File(file))
+	if err := WithConfig(loader, v, "svc").Load(ctx, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	expected := layers{Default: "default", File: "file", Global: "global", Path: "path", Env: "env", Flag: "flag"}
+	if cfg != expected {
+		t.Fatalf("loaded %+v, expected %+v", cfg, expected)
+	}
+}
@@ -0,0 +1,184 @@
+//Package vaulttest provides in-memory implementation of vault.IVault for unit tests without vault server
+package vaulttest
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+	"github.com/johnjerrico/gokit-starter-pack/pkg/vault"
+)
+
+const ciphertextPrefix = "vault:v1:"
+
+//Fake in-memory vault keeping k/v per path and transit keys created on first encryption like vault transit engine.
+//Ciphertext has vault format vault:v1:<base64> and decrypts only with the key it was encrypted with.
+type Fake struct {
+	mu   sync.RWMutex
+	kv   map[string]map[string]interface{}
+	keys map[string]cipher.AEAD
+	err  error
+}
+
+var _ vault.IVault = (*Fake)(nil)
+
+//New create empty fake vault
+func New() *Fake {
+	return &Fake{
+		kv:   make(map[string]map[string]interface{}),
+		keys: make(map[string]cipher.AEAD),
+	}
+}
+
+//FailWith make next calls fail with err, nil restores the fake
+func (f *Fake) FailWith(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+//Paths return every written path
+func (f *Fake) Paths() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	var paths []string
+	for path := range f.kv {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+//Read return copy of k/v of path, nil data when path does not exist
+func (f *Fake) Read(ctx context.Context, path string) (map[string]interface{}, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if err := f.check(ctx); err != nil {
+		return nil, err
+	}
+	data, ok := f.kv[strings.Trim(path, "/")]
+	if !ok {
+		return nil, nil
+	}
+	return clone(data), nil
+}
+
+//Write replace k/v of path with copy of data
+func (f *Fake) Write(ctx context.Context, path string, data map[string]interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx); err != nil {
+		return err
+	}
+	f.kv[strings.Trim(path, "/")] = clone(data)
+	return nil
+}
+
+//GetEnvOrDefaultConfig get configuration from config/global, config/{path} and environment as strings, see vault.GetConfig
+func (f *Fake) GetEnvOrDefaultConfig(ctx context.Context, path string, def interface{}) (map[string]string, error) {
+	return vault.GetConfig(ctx, f, path, def)
+}
+
+//LoadConfig fill configuration struct from config/global, config/{path} and environment, see vault.LoadConfig
+func (f *Fake) LoadConfig(ctx context.Context, path string, dst interface{}) error {
+	return vault.LoadConfig(ctx, f, path, dst)
+}
+
+//Encrypt encrypt plaintext with transit key, key is created when it does not exist
+func (f *Fake) Encrypt(ctx context.Context, transitkey string, plaintext []byte) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx); err != nil {
+		return "", err
+	}
+	key, ok := f.keys[transitkey]
+	if !ok {
+		sum := sha256.Sum256([]byte(transitkey))
+		block, err := aes.NewCipher(sum[:])
+		if err != nil {
+			return "", err
+		}
+		if key, err = cipher.NewGCM(block); err != nil {
+			return "", err
+		}
+		f.keys[transitkey] = key
+	}
+	nonce := make([]byte, key.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return ciphertextPrefix + base64.StdEncoding.EncodeToString(key.Seal(nonce, nonce, plaintext, []byte(transitkey))), nil
+}
+
+//Decrypt decrypt ciphertext of transit key, unknown key or ciphertext of another key fails with BADREQUEST error
+func (f *Fake) Decrypt(ctx context.Context, transitkey, ciphertext string) ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if err := f.check(ctx); err != nil {
+		return nil, err
+	}
+	key, ok := f.keys[transitkey]
+	if !ok {
+		return nil, rError.New(fmt.Errorf("encryption key %s not found", transitkey), rError.Enum.BADREQUEST, "encryption_key_not_found")
+	}
+	if !strings.HasPrefix(ciphertext, ciphertextPrefix) {
+		return nil, rError.New(fmt.Errorf("invalid ciphertext: no prefix"), rError.Enum.BADREQUEST, "invalid_ciphertext")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, ciphertextPrefix))
+	if err != nil || len(sealed) < key.NonceSize() {
+		return nil, rError.New(fmt.Errorf("invalid ciphertext: %v", err), rError.Enum.BADREQUEST, "invalid_ciphertext")
+	}
+	plaintext, err := key.Open(nil, sealed[:key.NonceSize()], sealed[key.NonceSize():], []byte(transitkey))
+	if err != nil {
+		return nil, rError.New(err, rError.Enum.BADREQUEST, "invalid_ciphertext")
+	}
+	return plaintext, nil
+}
+
+//WriteEncrypted write value encrypted with transit key into path/{id}, returns the id
+func (f *Fake) WriteEncrypted(ctx context.Context, transitkey, path string, value []byte) (string, error) {
+	ciphertext, err := f.Encrypt(ctx, transitkey, value)
+	if err != nil {
+		return "", err
+	}
+	id := uuid.New().String()
+	if err = f.Write(ctx, path+"/"+id, map[string]interface{}{"value": ciphertext}); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+//ReadEncrypted read and decrypt value written by WriteEncrypted, nil value when path does not exist and NOTFOUND error when path has no value
+func (f *Fake) ReadEncrypted(ctx context.Context, transitkey, path string) ([]byte, error) {
+	data, err := f.Read(ctx, path)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	ciphertext, ok := data["value"].(string)
+	if !ok {
+		return nil, rError.New(fmt.Errorf("vault path %s has no value", path), rError.Enum.NOTFOUND, "vault_value_not_found")
+	}
+	return f.Decrypt(ctx, transitkey, ciphertext)
+}
+
+func (f *Fake) check(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.err
+}
+
+func clone(data map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,124 @@
+package vaulttest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	rError "github.com/johnjerrico/gokit-starter-pack/pkg/error"
+)
+
+func kind(err error) int {
+	if rerr, ok := err.(*rError.Error); ok {
+		return rerr.Kind()
+	}
+	return -1
+}
+
+func TestFakeKV(t *testing.T) {
+	fake := New()
+	ctx := context.Background()
+	data := map[string]interface{}{"user": "app"}
+	if err := fake.Write(ctx, "/secret/db/", data); err != nil {
+		t.Fatal(err)
+	}
+	data["user"] = "changed"
+	read, err := fake.Read(ctx, "secret/db")
+	if err != nil || read["user"] != "app" {
+		t.Fatalf("read %v, err %v, expected copy of written data", read, err)
+	}
+	read["user"] = "changed"
+	if read, _ = fake.Read(ctx, "secret/db"); read["user"] != "app" {
+		t.Fatal("read data is not a copy")
+	}
+	if read, err = fake.Read(ctx, "secret/missing"); err != nil || read != nil {
+		t.Fatalf("missing path returned %v, err %v", read, err)
+	}
+	if paths := fake.Paths(); len(paths) != 1 || paths[0] != "secret/db" {
+		t.Fatalf("paths %v", paths)
+	}
+}
+
+func TestFakeTransit(t *testing.T) {
+	fake := New()
+	ctx := context.Background()
+	ciphertext, err := fake.Encrypt(ctx, "users", []byte("3201"))
+	if err != nil || !strings.HasPrefix(ciphertext, "vault:v1:") {
+		t.Fatalf("encrypted %q, err %v", ciphertext, err)
+	}
+	plaintext, err := fake.Decrypt(ctx, "users", ciphertext)
+	if err != nil || string(plaintext) != "3201" {
+		t.Fatalf("decrypted %q, err %v", plaintext, err)
+	}
+	if _, err = fake.Encrypt(ctx, "payments", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		transitkey string
+		ciphertext string
+	}{
+		{name: "unknown key", transitkey: "unknown", ciphertext: ciphertext},
+		{name: "other key", transitkey: "payments", ciphertext: ciphertext},
+		{name: "no prefix", transitkey: "users", ciphertext: strings.TrimPrefix(ciphertext, "vault:v1:")},
+		{name: "not base64", transitkey: "users", ciphertext: "vault:v1:%%%"},
+		{name: "tampered", transitkey: "users", ciphertext: ciphertext[:len(ciphertext)-4] + "AAA="},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if plaintext, err := fake.Decrypt(ctx, test.transitkey, test.ciphertext); kind(err) != rError.Enum.BADREQUEST {
+				t.Fatalf("decrypted %q, err %v, expected BADREQUEST", plaintext, err)
+			}
+		})
+	}
+}
+
+func TestFakeEncrypted(t *testing.T) {
+	fake := New()
+	ctx := context.Background()
+	id, err := fake.WriteEncrypted(ctx, "users", "secret/users", []byte("3201"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := fake.Read(ctx, "secret/users/"+id)
+	if value, _ := stored["value"].(string); !strings.HasPrefix(value, "vault:v1:") {
+		t.Fatalf("stored %v, expected ciphertext", stored)
+	}
+	value, err := fake.ReadEncrypted(ctx, "users", "secret/users/"+id)
+	if err != nil || string(value) != "3201" {
+		t.Fatalf("read %q, err %v", value, err)
+	}
+	if value, err = fake.ReadEncrypted(ctx, "users", "secret/users/missing"); err != nil || value != nil {
+		t.Fatalf("missing path returned %q, err %v", value, err)
+	}
+	if err = fake.Write(ctx, "secret/users/empty", map[string]interface{}{"other": "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if value, err = fake.ReadEncrypted(ctx, "users", "secret/users/empty"); kind(err) != rError.Enum.NOTFOUND {
+		t.Fatalf("path without value returned %q, err %v", value, err)
+	}
+}
+
+func TestFakeFailures(t *testing.T) {
+	fake := New()
+	failure := errors.New("vault is sealed")
+	fake.FailWith(failure)
+	if _, err := fake.Read(context.Background(), "secret/db"); err != failure {
+		t.Fatalf("failing fake returned %v", err)
+	}
+	if _, err := fake.Encrypt(context.Background(), "users", nil); err != failure {
+		t.Fatalf("failing fake returned %v", err)
+	}
+	fake.FailWith(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := fake.Write(ctx, "secret/db", nil); err != context.Canceled {
+		t.Fatalf("cancelled context returned %v", err)
+	}
+	if err := fake.Write(context.Background(), "secret/db", nil); err != nil {
+		t.Fatalf("restored fake returned %v", err)
+	}
+}